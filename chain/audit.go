@@ -0,0 +1,341 @@
+package chain
+
+import (
+	"errors"
+	"statistic/db"
+	"time"
+
+	"github.com/ChainSafe/log15"
+	"github.com/crustio/go-substrate-rpc-client/v4/types"
+)
+
+const auditPageSize = 200
+
+var ErrAuditTerminated = errors.New("audit terminated")
+
+// ErrAuditBlock is returned when auditing at a block other than the listener checkpoint,
+// file_info and replica only hold the state of the checkpoint
+var ErrAuditBlock = errors.New("audit is only allowed at the listener checkpoint")
+
+// AuditReport lists the files whose database rows differ from Market.FilesV2
+type AuditReport struct {
+	Block     uint64 // block the keys were listed at
+	Checked   int
+	Missing   []string // on chain but not in file_info
+	Extra     []string // in file_info but not on chain
+	Divergent []string // fields or replicas differ
+	Repaired  int
+}
+
+type auditor struct {
+	conn   *connection
+	store  db.Store
+	block  uint64 // 0 to follow the listener checkpoint
+	repair bool
+	log    log15.Logger
+	stop   <-chan int
+	report *AuditReport
+}
+
+// Audit compares file_info and replica with Market.FilesV2 at the listener checkpoint, block must be 0 or the checkpoint.
+// Every page of the database is read in one transaction with the checkpoint and compared with the chain state of that block.
+// With block 0 a page is audited again if the listener moved on meanwhile, so that the audit can run next to the live listener,
+// otherwise the audit fails once the checkpoint is no longer block.
+// With repair the database is fixed from the chain state in the same transaction.
+func Audit(conn *connection, store db.Store, block uint64, repair bool, logger log15.Logger, stop <-chan int) (*AuditReport, error) {
+	a := &auditor{conn, store, block, repair, logger, stop, &AuditReport{}}
+	number, hash, err := a.at()
+	if err != nil {
+		return a.report, err
+	}
+	a.report.Block = number
+	err = a.auditChainFiles(hash)
+	if err != nil {
+		return a.report, err
+	}
+	err = a.auditDbFiles()
+	return a.report, err
+}
+
+// at returns the listener checkpoint and its hash, it fails if the checkpoint is not the audited block
+func (a *auditor) at() (uint64, types.Hash, error) {
+	number, err := a.store.GetBlockNumber()
+	if err != nil {
+		return 0, types.Hash{}, err
+	}
+	if a.block != 0 && number != a.block {
+		return 0, types.Hash{}, ErrAuditBlock
+	}
+	hash, err := a.conn.getApi().RPC.Chain.GetBlockHash(number)
+	return number, hash, err
+}
+
+// atCheckpoint runs fn in a transaction if the listener checkpoint is still number.
+// It returns false if the listener has processed another block meanwhile, which fails the audit at a fixed block.
+func (a *auditor) atCheckpoint(number uint64, fn func(tx db.Store) error) (bool, error) {
+	moved := false
+	err := a.store.Transaction(func(tx db.Store) error {
+		current, err := tx.GetBlockNumber()
+		if err != nil {
+			return err
+		}
+		if current != number {
+			if a.block != 0 {
+				return ErrAuditBlock
+			}
+			moved = true
+			return nil
+		}
+		return fn(tx)
+	})
+	return err == nil && !moved, err
+}
+
+func (a *auditor) stopped() bool {
+	select {
+	case <-a.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// auditChainFiles pages through the FilesV2 keys at keysHash and finds missing and divergent files
+func (a *auditor) auditChainFiles(keysHash types.Hash) error {
+	startKey := ""
+	for {
+		if a.stopped() {
+			return ErrAuditTerminated
+		}
+		keys, err := a.conn.GetKeyPaged(FileV2Prefix, auditPageSize, startKey, &keysHash)
+		if err != nil {
+			return err
+		}
+		if len(keys) == 0 {
+			return nil
+		}
+		startKey = keys[len(keys)-1]
+
+		for done := false; !done; {
+			number, hash, err := a.at()
+			if err != nil {
+				return err
+			}
+			files, err := a.conn.GetFilesInfoV2ListWithKeys(keys, &hash)
+			if err != nil {
+				return err
+			}
+			done, err = a.atCheckpoint(number, func(tx db.Store) error {
+				return a.compareChainFiles(tx, number, files)
+			})
+			if err != nil {
+				return err
+			}
+		}
+		a.log.Info("audit chain files progress", "checked", a.report.Checked, "missing", len(a.report.Missing), "divergent", len(a.report.Divergent))
+	}
+}
+
+// compareChainFiles compares the chain files of block number with the database, tx is at the same block
+func (a *auditor) compareChainFiles(tx db.Store, number uint64, files []*StorageFile) error {
+	cids := make([]string, 0, len(files))
+	for _, file := range files {
+		cids = append(cids, file.Cid)
+	}
+	saved, err := tx.QueryFilesByCids(cids)
+	if err != nil {
+		return err
+	}
+	savedMap := make(map[string]*db.FileInfo, len(saved))
+	ids := make([]int, 0, len(saved))
+	for i := range saved {
+		savedMap[saved[i].Cid] = &saved[i]
+		ids = append(ids, saved[i].ID)
+	}
+	replicas, err := tx.ReplicasByFileIds(ids)
+	if err != nil {
+		return err
+	}
+
+	fixes := make([]*db.FileInfo, 0)
+	for _, file := range files {
+		a.report.Checked++
+		dto := file.File.ToFileDto(file.Cid, 0)
+		old, ok := savedMap[file.Cid]
+		if !ok {
+			a.log.Warn("Audit found missing file", "cid", file.Cid, "block", number)
+			a.report.Missing = append(a.report.Missing, file.Cid)
+		} else if fileDiverges(dto, old, replicas[old.ID]) {
+			a.log.Warn("Audit found divergent file", "cid", file.Cid, "block", number)
+			a.report.Divergent = append(a.report.Divergent, file.Cid)
+		} else {
+			continue
+		}
+		fixes = append(fixes, dto)
+	}
+	if !a.repair || len(fixes) == 0 {
+		return nil
+	}
+	return a.repairFiles(tx, number, fixes, nil)
+}
+
+// auditDbFiles pages through file_info and finds the files that are no longer on chain
+func (a *auditor) auditDbFiles() error {
+	lastId := 0
+	for {
+		if a.stopped() {
+			return ErrAuditTerminated
+		}
+		number, hash, err := a.at()
+		if err != nil {
+			return err
+		}
+		end := false
+		done, err := a.atCheckpoint(number, func(tx db.Store) error {
+			saved, err := tx.ListFiles(db.FileFilter{After: lastId, Limit: auditPageSize})
+			if err != nil {
+				return err
+			}
+			if len(saved) == 0 {
+				end = true
+				return nil
+			}
+			lastId = saved[len(saved)-1].ID
+			return a.compareDbFiles(tx, number, hash, saved)
+		})
+		if err != nil || (done && end) {
+			return err
+		}
+	}
+}
+
+// compareDbFiles finds the saved files missing on chain at block number, tx is at the same block
+func (a *auditor) compareDbFiles(tx db.Store, number uint64, hash types.Hash, saved []db.FileInfo) error {
+	cids := make([]string, 0, len(saved))
+	for _, f := range saved {
+		cids = append(cids, f.Cid)
+	}
+	files, err := a.conn.GetFilesInfoV2ListWithCids(cids, &hash)
+	if err != nil {
+		return err
+	}
+	onChain := make(map[string]bool, len(files))
+	for _, file := range files {
+		onChain[file.Cid] = true
+	}
+	extras := make([]string, 0)
+	for _, f := range saved {
+		if !onChain[f.Cid] {
+			a.log.Warn("Audit found extra file", "cid", f.Cid, "block", number)
+			extras = append(extras, f.Cid)
+		}
+	}
+	a.report.Extra = append(a.report.Extra, extras...)
+	if !a.repair || len(extras) == 0 {
+		return nil
+	}
+	return a.repairFiles(tx, number, nil, extras)
+}
+
+// repairFiles saves the chain state of fixes and closes extras, tx is at block number
+func (a *auditor) repairFiles(tx db.Store, number uint64, fixes []*db.FileInfo, extras []string) error {
+	cids := append([]string{}, extras...)
+	for _, f := range fixes {
+		cids = append(cids, f.Cid)
+	}
+	err := db.WithFileStats(tx, cids, func() error {
+		for _, cid := range extras {
+			if err := tx.CloseByCid(cid, number, db.CloseReasonAudit); err != nil {
+				return err
+			}
+		}
+		return tx.UpdateReplicasBatch(fixes)
+	})
+	if err != nil {
+		return err
+	}
+	a.report.Repaired += len(cids)
+	return nil
+}
+
+// fileDiverges tells whether the saved file and its replicas differ from the chain file dto
+func fileDiverges(dto *db.FileInfo, saved *db.FileInfo, replicas []db.Replica) bool {
+	if dto.FileSize != saved.FileSize ||
+		dto.Spower != saved.Spower ||
+		dto.ExpiredAt != saved.ExpiredAt ||
+		dto.CalculatedAt != saved.CalculatedAt ||
+		dto.Amount != saved.Amount ||
+		dto.Prepaid != saved.Prepaid ||
+		dto.ReportedReplicaCnt != saved.ReportedReplicaCnt ||
+		dto.RemainingPaidCnt != saved.RemainingPaidCnt {
+		return true
+	}
+	if len(dto.Replicas) != len(replicas) {
+		return true
+	}
+	// replicas are keyed by group owner on chain
+	savedReplicas := make(map[string]db.Replica, len(replicas))
+	for _, r := range replicas {
+		savedReplicas[r.GroupOwner] = r
+	}
+	for _, r := range dto.Replicas {
+		old, ok := savedReplicas[r.GroupOwner]
+		if !ok || old.Who != r.Who || old.ValidAt != r.ValidAt || old.Anchor != r.Anchor ||
+			old.IsReported != r.IsReported || old.CreateAt != r.CreateAt {
+			return true
+		}
+	}
+	return false
+}
+
+type auditJob struct {
+	conn       *connection
+	store      db.Store
+	interval   time.Duration
+	repair     bool
+	log        log15.Logger
+	stop       <-chan int
+	completeCh <-chan int
+}
+
+func NewAuditJob(conn *connection, store db.Store, interval time.Duration, repair bool, logger log15.Logger, stop <-chan int, completeCh <-chan int) *auditJob {
+	return &auditJob{
+		conn,
+		store,
+		interval,
+		repair,
+		logger,
+		stop,
+		completeCh,
+	}
+}
+
+// start audits the database every interval at the listener checkpoint, it does nothing if interval is 0
+func (j *auditJob) start() {
+	if j.interval <= 0 {
+		return
+	}
+	go func() {
+		select {
+		case <-j.stop:
+			return
+		case <-j.completeCh:
+		}
+		ticker := time.NewTicker(j.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-j.stop:
+				return
+			case <-ticker.C:
+				report, err := Audit(j.conn, j.store, 0, j.repair, j.log, j.stop)
+				if err != nil {
+					j.log.Error("Audit files failed", "err", err)
+					continue
+				}
+				j.log.Info("Audit files done", "block", report.Block, "checked", report.Checked, "missing", len(report.Missing),
+					"extra", len(report.Extra), "divergent", len(report.Divergent), "repaired", report.Repaired)
+			}
+		}
+	}()
+}
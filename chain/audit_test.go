@@ -0,0 +1,90 @@
+package chain
+
+import (
+	"statistic/config"
+	"statistic/db"
+	"testing"
+
+	"github.com/ChainSafe/log15"
+
+	"gotest.tools/assert"
+)
+
+func TestFileDiverges(t *testing.T) {
+	file := &FileInfoV2{
+		FileSize:             1024,
+		Spower:               2048,
+		ExpiredAt:            1000,
+		Amount:               "10",
+		Prepaid:              "0",
+		ReportedReplicaCount: 1,
+		Replicas: map[string]Replica{
+			"0x1aa7b7b1b4bd3ba6e4a0b5b0c9a41bd6bd1d7f3a5b0e03c6bcbbbd4d1b0a3d6e": {Who: "0x1aa7b7b1b4bd3ba6e4a0b5b0c9a41bd6bd1d7f3a5b0e03c6bcbbbd4d1b0a3d6e", ValidAt: 10, Anchor: "0x01", IsReported: true},
+		},
+	}
+	dto := file.ToFileDto(TestCid, 0)
+	saved := *file.ToFileDto(TestCid, 0)
+	replicas := append([]db.Replica{}, dto.Replicas...)
+	replicas[0].ID, replicas[0].FileId = 3, 1
+	assert.Equal(t, fileDiverges(dto, &saved, replicas), false)
+
+	saved.ExpiredAt = 900
+	assert.Equal(t, fileDiverges(dto, &saved, replicas), true)
+	saved.ExpiredAt = dto.ExpiredAt
+
+	replicas[0].IsReported = false
+	assert.Equal(t, fileDiverges(dto, &saved, replicas), true)
+	assert.Equal(t, fileDiverges(dto, &saved, nil), true)
+}
+
+func TestAuditOnlyAtCheckpoint(t *testing.T) {
+	store, err := db.NewStore(config.DbConfig{Type: db.TypeSqlite, Name: ":memory:"})
+	assert.NilError(t, err)
+	_, err = store.GetBlockNumber()
+	assert.NilError(t, err)
+	assert.NilError(t, store.UpdateBlockNumber(200))
+
+	// the database only holds the state of the checkpoint, in report mode too
+	_, err = Audit(nil, store, 100, false, log15.Root(), nil)
+	assert.Equal(t, err, ErrAuditBlock)
+
+	called := false
+	fn := func(tx db.Store) error {
+		called = true
+		return nil
+	}
+	// the listener moves on while an audit at a fixed block is running
+	a := &auditor{store: store, block: 100, log: log15.Root(), report: &AuditReport{}}
+	_, err = a.atCheckpoint(100, fn)
+	assert.Equal(t, err, ErrAuditBlock)
+	a.block = 0
+	done, err := a.atCheckpoint(100, fn)
+	assert.NilError(t, err)
+	assert.Equal(t, done, false)
+	assert.Equal(t, called, false)
+	done, err = a.atCheckpoint(200, fn)
+	assert.NilError(t, err)
+	assert.Equal(t, done, true)
+	assert.Equal(t, called, true)
+}
+
+func TestAuditRepairsMissingFile(t *testing.T) {
+	store, err := db.NewStore(config.DbConfig{Type: db.TypeSqlite, Name: ":memory:"})
+	assert.NilError(t, err)
+	_, err = store.GetBlockNumber()
+	assert.NilError(t, err)
+	assert.NilError(t, store.UpdateBlockNumber(200))
+
+	a := &auditor{store: store, repair: true, log: log15.Root(), report: &AuditReport{}}
+	files := []*StorageFile{{Cid: TestCid, File: &FileInfoV2{FileSize: 1024, ExpiredAt: 1000, Amount: "10", Prepaid: "0"}}}
+	done, err := a.atCheckpoint(200, func(tx db.Store) error {
+		return a.compareChainFiles(tx, 200, files)
+	})
+	assert.NilError(t, err)
+	assert.Equal(t, done, true)
+	assert.DeepEqual(t, a.report.Missing, []string{TestCid})
+	assert.Equal(t, a.report.Repaired, 1)
+	file, err := store.QueryFileByCid(TestCid)
+	assert.NilError(t, err)
+	assert.Equal(t, file.FileSize, uint64(1024))
+}
@@ -4,6 +4,7 @@ import (
 	"github.com/ChainSafe/log15"
 	"statistic/config"
 	"statistic/db"
+	"time"
 )
 
 var DefaultConn *connection
@@ -15,17 +16,20 @@ type Chain struct {
 	conn         *connection // THe chains connection
 	fetcher      *fetcher
 	listener     *listener
+	retrier      *errorRetrier
+	audit        *auditJob
+	feed         *ChangeFeed
 	stop         chan<- int
 	logger       log15.Logger
 }
 
-func NewChain(cfg config.ChainConfig, logger log15.Logger) (*Chain, error) {
+func NewChain(cfg config.ChainConfig, store db.Store, logger log15.Logger) (*Chain, error) {
 
 	stop := make(chan int)
 	// Setup connection
 	conns := [3]*connection{}
 	for i := 0; i < 3; i++ {
-		conn := NewConnection(cfg.Url, logger, stop)
+		conn := NewConnection(cfg.Urls, logger, stop)
 		err := conn.Connect()
 		if err != nil {
 			return nil, err
@@ -35,18 +39,21 @@ func NewChain(cfg config.ChainConfig, logger log15.Logger) (*Chain, error) {
 
 	setDefaultConn(conns[0])
 	initBlock := uint64(cfg.StartBlock)
-	startBlock, err := db.GetBlockNumber()
+	startBlock, err := store.GetBlockNumber()
 
 	if err != nil {
 		return nil, err
 	}
 	// Setup fetcher & listener
-	f := NewFetcher(conns, cfg, startBlock, logger, stop)
+	f := NewFetcher(conns, cfg, store, startBlock, logger, stop)
 
 	if startBlock == 0 {
 		startBlock = initBlock + 1
 	}
-	l := NewListener(conns[0], startBlock, uint64(cfg.Confirm), logger, stop, f.getCompleteCh(), cfg.UseMarketUpdate)
+	l := NewListener(conns[0], store, startBlock, uint64(cfg.Confirm), logger, stop, f.getCompleteCh(), enabledEventHandlers(cfg))
+	l.feed = NewChangeFeed(cfg.StreamBuffer, startBlock)
+	r := NewErrorRetrier(conns[2], store, time.Duration(cfg.ErrorRetryInterval)*time.Second, cfg.ErrorMaxAttempts, logger, stop, f.getCompleteCh())
+	a := NewAuditJob(conns[2], store, time.Duration(cfg.AuditInterval)*time.Second, cfg.AuditRepair, logger, stop, f.getCompleteCh())
 
 	return &Chain{
 		startBlock: cfg.StartBlock,
@@ -55,8 +62,22 @@ func NewChain(cfg config.ChainConfig, logger log15.Logger) (*Chain, error) {
 		logger:     logger,
 		fetcher:    f,
 		listener:   l,
+		retrier:    r,
+		audit:      a,
+		feed:       l.feed,
 	}, nil
 }
+
+// Connect opens a single connection to the configured endpoints, used by one-off commands
+func Connect(cfg config.ChainConfig, logger log15.Logger, stop <-chan int) (*connection, error) {
+	conn := NewConnection(cfg.Urls, logger, stop)
+	err := conn.Connect()
+	if err != nil {
+		return nil, err
+	}
+	setDefaultConn(conn)
+	return conn, nil
+}
 func setDefaultConn(conn *connection) {
 	DefaultConn = conn
 }
@@ -64,6 +85,8 @@ func setDefaultConn(conn *connection) {
 func (c *Chain) Start() {
 	c.fetcher.start()
 	c.listener.start()
+	c.retrier.start()
+	c.audit.start()
 }
 
 func (c *Chain) Stop() {
@@ -73,3 +96,8 @@ func (c *Chain) Stop() {
 func (c *Chain) FetchCompleteCh() <-chan int {
 	return c.fetcher.getCompleteCh()
 }
+
+// Feed returns the changes applied by the listener
+func (c *Chain) Feed() *ChangeFeed {
+	return c.feed
+}
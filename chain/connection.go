@@ -1,6 +1,7 @@
 package chain
 
 import (
+	"errors"
 	"github.com/ChainSafe/log15"
 	gsrpc "github.com/crustio/go-substrate-rpc-client/v4"
 	"github.com/crustio/go-substrate-rpc-client/v4/types"
@@ -8,20 +9,37 @@ import (
 	"github.com/crustio/scale.go/types/scaleBytes"
 	"github.com/crustio/scale.go/utiles"
 	"sync"
+	"time"
+)
+
+const (
+	HealthCheckInterval  = time.Second * 10
+	ReconnectMinInterval = time.Second
+	ReconnectMaxInterval = time.Minute
 )
 
 type connection struct {
-	api      *gsrpc.SubstrateAPI
-	log      log15.Logger
-	url      string         // API endpoint
-	meta     types.Metadata // Latest chain metadata
-	metaLock sync.RWMutex   // Lock metadata for updates, allows concurrent reads
-	stop     <-chan int     // Signals system shutdown, should be observed in all selects and loops
+	api         *gsrpc.SubstrateAPI
+	apiLock     sync.RWMutex // Lock api for reconnects, allows concurrent reads
+	log         log15.Logger
+	urls        []string       // API endpoints, rotated on failure
+	index       int            // Index of the endpoint in use
+	meta        types.Metadata // Latest chain metadata
+	specVersion uint32         // Runtime spec version of meta
+	metaLock    sync.RWMutex   // Lock metadata for updates, allows concurrent reads
+	stop        <-chan int     // Signals system shutdown, should be observed in all selects and loops
 }
 
-func NewConnection(url string, log log15.Logger, stop <-chan int) *connection {
+func NewConnection(urls []string, log log15.Logger, stop <-chan int) *connection {
 
-	return &connection{url: url, log: log, stop: stop}
+	return &connection{urls: urls, log: log, stop: stop}
+}
+
+func (c *connection) getApi() *gsrpc.SubstrateAPI {
+	c.apiLock.RLock()
+	api := c.api
+	c.apiLock.RUnlock()
+	return api
 }
 
 func (c *connection) getMetadata() *types.Metadata {
@@ -31,46 +49,120 @@ func (c *connection) getMetadata() *types.Metadata {
 	return &meta
 }
 
-func (c *connection) updateMetadata(hash *types.Hash) error {
-	c.metaLock.Lock()
-	meta, err := c.api.RPC.State.GetMetadata(*hash)
-	if err != nil {
-		c.metaLock.Unlock()
-		return err
+// Connect tries every endpoint in order and keeps the connection alive in the background
+func (c *connection) Connect() error {
+	if len(c.urls) == 0 {
+		return errors.New("no endpoint configured")
 	}
-	c.meta = *meta
-	c.metaLock.Unlock()
-	return nil
+	var err error
+	for i := 0; i < len(c.urls); i++ {
+		err = c.dial(c.urls[c.index])
+		if err == nil {
+			go c.keepAlive()
+			return nil
+		}
+		c.log.Error("Failed to connect endpoint", "url", c.urls[c.index], "err", err)
+		c.index = (c.index + 1) % len(c.urls)
+	}
+	return err
 }
 
-func (c *connection) Connect() error {
-	c.log.Info("Connecting to substrate chain...", "url", c.url)
-	api, err := gsrpc.NewSubstrateAPI(c.url)
+// dial opens a new api to url and fetches the latest metadata before replacing the one in use
+func (c *connection) dial(url string) error {
+	c.log.Info("Connecting to substrate chain...", "url", url)
+	api, err := gsrpc.NewSubstrateAPI(url)
 	if err != nil {
 		return err
 	}
 	opts := types.SerDeOptions{NoPalletIndices: true}
 	types.SetSerDeOptions(opts)
-	c.api = api
-	// Fetch metadata
-	meta, err := api.RPC.State.GetMetadataLatest()
+	// Fetch metadata, refetched on every reconnect
+	c.metaLock.Lock()
+	c.specVersion = 0
+	c.metaLock.Unlock()
+	err = c.updateLatestMetadata(api)
 	if err != nil {
+		closeApi(api)
 		return err
 	}
-	c.meta = *meta
-	c.log.Info("Fetched substrate metadata complete")
+
+	c.apiLock.Lock()
+	old := c.api
+	c.api = api
+	c.apiLock.Unlock()
+	if old != nil {
+		closeApi(old)
+	}
+	c.log.Info("Fetched substrate metadata complete", "url", url)
 	return nil
 }
 
-func (c *connection) GetEvents(meta *types.Metadata, hash *types.Hash) (*Events, error) {
+// keepAlive checks the endpoint periodically and reconnects when it stops responding,
+// the same check switches the latest metadata after a runtime upgrade
+func (c *connection) keepAlive() {
+	ticker := time.NewTicker(HealthCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.stop:
+			closeApi(c.getApi())
+			return
+		case <-ticker.C:
+			err := c.updateLatestMetadata(c.getApi())
+			if err == nil {
+				continue
+			}
+			c.log.Warn("Endpoint not responding, reconnecting", "url", c.urls[c.index], "err", err)
+			c.reconnect()
+		}
+	}
+}
+
+// reconnect rotates through the endpoints with backoff until one of them is healthy
+func (c *connection) reconnect() {
+	backoff := ReconnectMinInterval
+	for {
+		c.index = (c.index + 1) % len(c.urls)
+		err := c.dial(c.urls[c.index])
+		if err == nil {
+			c.log.Info("Reconnected to substrate chain", "url", c.urls[c.index])
+			return
+		}
+		c.log.Error("Failed to reconnect endpoint", "url", c.urls[c.index], "err", err, "retry", backoff)
+		select {
+		case <-c.stop:
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > ReconnectMaxInterval {
+			backoff = ReconnectMaxInterval
+		}
+	}
+}
+
+func closeApi(api *gsrpc.SubstrateAPI) {
+	if api == nil {
+		return
+	}
+	if cl, ok := api.Client.(interface{ Close() }); ok {
+		cl.Close()
+	}
+}
+
+func (c *connection) GetEvents(hash *types.Hash) (*Events, error) {
 	c.log.Trace("Fetching block for events", "hash", hash.Hex())
+	meta, err := c.metadataAt(hash)
+	if err != nil {
+		return nil, err
+	}
 	key, err := types.CreateStorageKey(meta, "System", "Events", nil, nil)
 	if err != nil {
 		return nil, err
 	}
 
 	var records types.EventRecordsRaw
-	_, err = c.api.RPC.State.GetStorage(key, &records, *hash)
+	_, err = c.getApi().RPC.State.GetStorage(key, &records, *hash)
 	if err != nil {
 		return nil, err
 	}
@@ -84,7 +176,11 @@ func (c *connection) GetEvents(meta *types.Metadata, hash *types.Hash) (*Events,
 }
 
 func (c *connection) GetFilesInfoV2(cid string, hash *types.Hash) (*FileInfoV2, error) {
-	key, err := c.generateFileKey([]byte(cid))
+	meta, err := c.metadataAt(hash)
+	if err != nil {
+		return nil, err
+	}
+	key, err := generateFileKey(meta, []byte(cid))
 	if err != nil {
 		return nil, err
 	}
@@ -109,10 +205,14 @@ func (c *connection) GetFilesInfoV2ListWithCids(cids []string, hash *types.Hash)
 	if len(cids) == 0 {
 		return nil, nil
 	}
+	meta, err := c.metadataAt(hash)
+	if err != nil {
+		return nil, err
+	}
 	query := make([]types.StorageKey, 0, len(cids))
 	keys := make(map[string]string)
 	for _, cid := range cids {
-		key, err := c.generateFileStorageKey(cid)
+		key, err := getCidStorageKey(meta, cid)
 		if err != nil {
 			return nil, err
 		}
@@ -190,27 +290,27 @@ func (c *connection) queryFileStorages(query []types.StorageKey, hash *types.Has
 }
 
 func (c *connection) GetKeyPaged(prefix string, size uint32, startKey string, blockHash *types.Hash) ([]string, error) {
-	return c.api.RPC.State.GetKeysPaged(prefix, size, startKey, blockHash)
+	return c.getApi().RPC.State.GetKeysPaged(prefix, size, startKey, blockHash)
 }
 
 func (c *connection) GetStorageRaw(key string, blockHash *types.Hash) (*types.StorageDataRaw, error) {
-	return c.api.RPC.State.GetStorageRaw(types.MustHexDecodeString(key), *blockHash)
+	return c.getApi().RPC.State.GetStorageRaw(types.MustHexDecodeString(key), *blockHash)
 }
 
 func (c *connection) GetStorageRawLatest(key types.StorageKey) (*types.StorageDataRaw, error) {
-	return c.api.RPC.State.GetStorageRawLatest(key)
+	return c.getApi().RPC.State.GetStorageRawLatest(key)
 }
 
 func (c *connection) GetBlock(hash *types.Hash) (*types.SignedBlock, error) {
-	return c.api.RPC.Chain.GetBlock(*hash)
+	return c.getApi().RPC.Chain.GetBlock(*hash)
 }
 
 func (c *connection) QueryStorageAt(keys []types.StorageKey, blockHash *types.Hash) ([]types.StorageChangeSet, error) {
-	return c.api.RPC.State.QueryStorageAt(keys, blockHash)
+	return c.getApi().RPC.State.QueryStorageAt(keys, blockHash)
 }
 
 func (c *connection) GetLatestHeight() uint64 {
-	header, err := c.api.RPC.Chain.GetHeaderLatest()
+	header, err := c.getApi().RPC.Chain.GetHeaderLatest()
 	if err != nil {
 		return 0
 	}
@@ -218,41 +318,65 @@ func (c *connection) GetLatestHeight() uint64 {
 }
 
 func (c *connection) GetTimestamp() (int64, error) {
-	block, err := c.api.RPC.Chain.GetBlockLatest()
+	block, err := c.getApi().RPC.Chain.GetBlockLatest()
 	if err != nil {
 		return 0, err
 	}
-	ext := block.Block.Extrinsics[0]
-	var val types.UCompact
-	err = types.DecodeFromBytes(ext.Method.Args, &val)
+	return blockTimestamp(block)
+}
+
+// timestampNowKey is the storage key of Timestamp.Now
+var timestampNowKey = getPrefix("Timestamp", "Now")
+
+// GetTimestampAt reads Timestamp.Now at the block, in second, without downloading the block
+func (c *connection) GetTimestampAt(hash *types.Hash) (int64, error) {
+	data, err := c.GetStorageRaw(timestampNowKey, hash)
 	if err != nil {
 		return 0, err
 	}
-	return val.Int64() / 1000, nil
+	return decodeTimestampNow(*data)
 }
 
-func (c *connection) generateFileKey(cid []byte) (string, error) {
-	return generateFileKey(&c.meta, cid)
+func decodeTimestampNow(data types.StorageDataRaw) (int64, error) {
+	if len(data) == 0 {
+		return 0, errors.New("block has no timestamp")
+	}
+	var val types.U64
+	err := types.DecodeFromBytes(data, &val)
+	if err != nil {
+		return 0, err
+	}
+	return int64(val) / 1000, nil
 }
 
-func (c *connection) generateKey(prefix, method string, args ...[]byte) (types.StorageKey, error) {
-	return types.CreateStorageKey(&c.meta, prefix, method, args...)
+// blockTimestamp decodes the Timestamp.set inherent of block, in second
+func blockTimestamp(block *types.SignedBlock) (int64, error) {
+	if len(block.Block.Extrinsics) == 0 {
+		return 0, errors.New("block has no timestamp")
+	}
+	ext := block.Block.Extrinsics[0]
+	var val types.UCompact
+	err := types.DecodeFromBytes(ext.Method.Args, &val)
+	if err != nil {
+		return 0, err
+	}
+	return val.Int64() / 1000, nil
 }
 
-func (c *connection) generateFileStorageKey(cid string) (types.StorageKey, error) {
-	return getCidStorageKey(&c.meta, cid)
+func (c *connection) generateKey(prefix, method string, args ...[]byte) (types.StorageKey, error) {
+	return types.CreateStorageKey(c.getMetadata(), prefix, method, args...)
 }
 
 func (c *connection) GetKeysCnt(prefix, method string) (int, error) {
 	prefixKeys := getPrefix(prefix, method)
 	startKey := prefixKeys
-	hash, err := c.api.RPC.Chain.GetBlockHashLatest()
+	hash, err := c.getApi().RPC.Chain.GetBlockHashLatest()
 	if err != nil {
 		return 0, err
 	}
 	cnt := 0
 	for {
-		keys, err := c.api.RPC.State.GetKeysPaged(prefixKeys, 1000, startKey, &hash)
+		keys, err := c.getApi().RPC.State.GetKeysPaged(prefixKeys, 1000, startKey, &hash)
 		if err != nil {
 			return 0, err
 		}
@@ -8,14 +8,14 @@ import (
 
 func getConnection() *connection {
 	stop := make(chan int)
-	conn := NewConnection(TestUrl, log.Root(), stop)
+	conn := NewConnection([]string{TestUrl}, log.Root(), stop)
 	conn.Connect()
 	return conn
 }
 
 func TestQueryKeysFile(t *testing.T) {
 	stop := make(chan int)
-	conn := NewConnection(TestUrl, log.Root(), stop)
+	conn := NewConnection([]string{TestUrl}, log.Root(), stop)
 	conn.Connect()
 	api := conn.api
 	meta, err := api.RPC.State.GetMetadataLatest()
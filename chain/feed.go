@@ -0,0 +1,200 @@
+package chain
+
+import (
+	"errors"
+	"sort"
+	"statistic/db"
+	"sync"
+)
+
+// Types of the changes pushed by the listener
+const (
+	ChangeNew     = "new"
+	ChangeRenewal = "renewal"
+	ChangeReplica = "replica"
+	ChangeClose   = "close"
+)
+
+var ErrChangesPruned = errors.New("changes are no longer buffered")
+
+// Change is a file change applied by the listener
+type Change struct {
+	Seq      uint64   `json:"seq"`
+	Block    uint64   `json:"block"`
+	Hash     string   `json:"hash"`
+	Type     string   `json:"type"`
+	Cid      string   `json:"cid"`
+	Reason   string   `json:"reason,omitempty"`   // close reason
+	Accounts []string `json:"accounts,omitempty"` // group owners and storage accounts of the replicas
+}
+
+// ChangeFeed keeps the latest changes in a bounded ring buffer and wakes up the readers on publish
+type ChangeFeed struct {
+	mu     sync.Mutex
+	buf    []Change
+	head   int // index of the oldest change
+	size   int
+	seq    uint64
+	floor  uint64 // the changes of every block from floor on are in the buffer
+	notify chan struct{}
+}
+
+// NewChangeFeed creates a feed of capacity changes, the listener publishes from block floor on
+func NewChangeFeed(capacity int, floor uint64) *ChangeFeed {
+	if capacity <= 0 {
+		capacity = 1
+	}
+	return &ChangeFeed{
+		buf:    make([]Change, capacity),
+		floor:  floor,
+		notify: make(chan struct{}),
+	}
+}
+
+// Publish appends the changes of a committed block, the oldest changes are dropped when the buffer is full
+func (f *ChangeFeed) Publish(changes []Change) {
+	if len(changes) == 0 {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, c := range changes {
+		if f.size == len(f.buf) {
+			f.floor = f.buf[f.head].Block + 1
+			f.head = (f.head + 1) % len(f.buf)
+			f.size--
+		}
+		f.seq++
+		c.Seq = f.seq
+		f.buf[(f.head+f.size)%len(f.buf)] = c
+		f.size++
+	}
+	close(f.notify)
+	f.notify = make(chan struct{})
+}
+
+// From returns the buffered changes of blocks from block on, the seq of the latest change
+// and a channel closed on the next publish
+func (f *ChangeFeed) From(block uint64) ([]Change, uint64, <-chan struct{}, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if block < f.floor {
+		return nil, 0, nil, ErrChangesPruned
+	}
+	return f.collect(func(c *Change) bool { return c.Block >= block }), f.seq, f.notify, nil
+}
+
+// After returns the buffered changes after seq, the seq of the latest change and a channel closed on the next publish
+func (f *ChangeFeed) After(seq uint64) ([]Change, uint64, <-chan struct{}, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if seq > f.seq || (f.size > 0 && seq+1 < f.buf[f.head].Seq) {
+		return nil, 0, nil, ErrChangesPruned
+	}
+	return f.collect(func(c *Change) bool { return c.Seq > seq }), f.seq, f.notify, nil
+}
+
+// Latest returns the seq of the latest change and a channel closed on the next publish
+func (f *ChangeFeed) Latest() (uint64, <-chan struct{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.seq, f.notify
+}
+
+func (f *ChangeFeed) collect(match func(c *Change) bool) []Change {
+	res := make([]Change, 0)
+	for i := 0; i < f.size; i++ {
+		c := &f.buf[(f.head+i)%len(f.buf)]
+		if match(c) {
+			res = append(res, *c)
+		}
+	}
+	return res
+}
+
+// blockChanges lists the file changes applied for ctx, files missing on chain were not applied and are skipped.
+// A renewed file gets a renewal change even if a replica update of the same block overrode its op.
+func blockChanges(ctx *BlockContext, cidMap map[string]*StorageFile) []Change {
+	hash := ctx.Hash.Hex()
+	changes := make([]Change, 0, len(ctx.ops))
+	renewed := make(map[string]bool, len(ctx.renewedCids))
+	for cid, op := range ctx.ops {
+		c := Change{Block: ctx.Number, Hash: hash, Cid: cid}
+		switch op {
+		case New:
+			c.Type = ChangeNew
+		case UpdateBase:
+			c.Type = ChangeRenewal
+		case UpdateRep:
+			c.Type = ChangeReplica
+		case Delete:
+			c.Type, c.Reason = ChangeClose, db.CloseReasonClosed
+		case IllegalDelete:
+			c.Type, c.Reason = ChangeClose, db.CloseReasonIllegal
+		}
+		if c.Type == ChangeClose {
+			c.Accounts = ctx.closedAccounts[cid]
+		} else {
+			file, ok := cidMap[cid]
+			if !ok {
+				continue
+			}
+			c.Accounts = replicaAccounts(file.File)
+		}
+		if c.Type == ChangeRenewal {
+			renewed[cid] = true
+		}
+		changes = append(changes, c)
+	}
+	for _, cid := range ctx.renewedCids {
+		file, ok := cidMap[cid]
+		if !ok || renewed[cid] {
+			continue
+		}
+		renewed[cid] = true
+		changes = append(changes, Change{Block: ctx.Number, Hash: hash, Type: ChangeRenewal, Cid: cid, Accounts: replicaAccounts(file.File)})
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Cid != changes[j].Cid {
+			return changes[i].Cid < changes[j].Cid
+		}
+		return changes[i].Type < changes[j].Type
+	})
+	return changes
+}
+
+// replicaAccounts returns the SS58 group owners and storage accounts of the replicas, as saved in the replica table
+func replicaAccounts(file *FileInfoV2) []string {
+	seen := make(map[string]bool, len(file.Replicas)*2)
+	accounts := make([]string, 0, len(file.Replicas)*2)
+	for owner, r := range file.Replicas {
+		for _, hex := range []string{owner, r.Who} {
+			if hex == "" {
+				continue
+			}
+			acc := convertAccount(hex)
+			if !seen[acc] {
+				seen[acc] = true
+				accounts = append(accounts, acc)
+			}
+		}
+	}
+	sort.Strings(accounts)
+	return accounts
+}
+
+// savedReplicaAccounts returns the group owners and storage accounts of saved replicas
+func savedReplicaAccounts(replicas []db.Replica) []string {
+	seen := make(map[string]bool, len(replicas)*2)
+	accounts := make([]string, 0, len(replicas)*2)
+	for _, r := range replicas {
+		for _, acc := range []string{r.GroupOwner, r.Who} {
+			if acc != "" && !seen[acc] {
+				seen[acc] = true
+				accounts = append(accounts, acc)
+			}
+		}
+	}
+	sort.Strings(accounts)
+	return accounts
+}
@@ -0,0 +1,73 @@
+package chain
+
+import (
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestChangeFeed(t *testing.T) {
+	feed := NewChangeFeed(3, 100)
+	seq, wait := feed.Latest()
+	assert.Equal(t, seq, uint64(0))
+
+	feed.Publish([]Change{{Block: 100, Cid: "a"}, {Block: 100, Cid: "b"}})
+	select {
+	case <-wait:
+	default:
+		t.Fatal("readers are not woken up on publish")
+	}
+	changes, seq, _, err := feed.From(100)
+	assert.NilError(t, err)
+	assert.Equal(t, len(changes), 2)
+	assert.Equal(t, seq, uint64(2))
+
+	// the changes of block 100 are dropped once the buffer is full
+	feed.Publish([]Change{{Block: 101, Cid: "c"}, {Block: 102, Cid: "d"}})
+	_, _, _, err = feed.From(100)
+	assert.Equal(t, err, ErrChangesPruned)
+	changes, _, _, err = feed.From(101)
+	assert.NilError(t, err)
+	assert.Equal(t, len(changes), 2)
+	assert.Equal(t, changes[0].Seq, uint64(3))
+
+	changes, seq, _, err = feed.After(2)
+	assert.NilError(t, err)
+	assert.Equal(t, len(changes), 2)
+	assert.Equal(t, seq, uint64(4))
+	_, _, _, err = feed.After(0)
+	assert.Equal(t, err, ErrChangesPruned)
+	_, _, _, err = feed.After(5)
+	assert.Equal(t, err, ErrChangesPruned)
+}
+
+func TestBlockChanges(t *testing.T) {
+	ctx := testBlockContext()
+	ctx.ops = map[string]int{"new": New, "gone": New, "renewed": UpdateBase, "closed": IllegalDelete}
+	cidMap := map[string]*StorageFile{
+		"new": {Cid: "new", File: &FileInfoV2{Replicas: map[string]Replica{
+			"0xd43593c715fdd31c61141abd04a99fd6822c8558854ccde39a5684e7a56da27d": {Who: "0x1aa7b7b1b4bd3ba6e4a0b5b0c9a41bd6bd1d7f3a5b0e03c6bcbbbd4d1b0a3d6e"},
+		}}},
+		"renewed": {Cid: "renewed", File: &FileInfoV2{}},
+	}
+	changes := blockChanges(ctx, cidMap)
+	assert.Equal(t, len(changes), 3)
+	assert.Equal(t, changes[0].Cid, "closed")
+	assert.Equal(t, changes[0].Type, ChangeClose)
+	assert.Equal(t, changes[0].Reason, "illegal")
+	assert.Equal(t, changes[1].Type, ChangeNew)
+	assert.DeepEqual(t, changes[1].Accounts, []string{"cTGwauz2FgX6dwpGtnD66VML7LzN8kjLsSpnKFuoWZvMH12ta", "cTM8suyN19VZb7JEPRNvtezyfpEAJyYxHkk1n5J4XEr6XroRa"})
+	assert.Equal(t, changes[2].Type, ChangeRenewal)
+	assert.Equal(t, changes[2].Block, ctx.Number)
+}
+
+func TestBlockChangesRenewalWithReplicaUpdate(t *testing.T) {
+	ctx := testBlockContext()
+	ctx.ops = map[string]int{"renewed": UpdateRep}
+	ctx.renewedCids = []string{"renewed", "renewed"}
+	cidMap := map[string]*StorageFile{"renewed": {Cid: "renewed", File: &FileInfoV2{}}}
+	changes := blockChanges(ctx, cidMap)
+	assert.Equal(t, len(changes), 2)
+	assert.Equal(t, changes[0].Type, ChangeRenewal)
+	assert.Equal(t, changes[1].Type, ChangeReplica)
+}
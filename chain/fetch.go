@@ -14,18 +14,46 @@ const FileV2Prefix = "0x5ebf094108ead4fefa73f7a3b13cb4a76ed21091d079415ef4a35264
 
 const RetryCnt = 5
 
+// snapshotPageSize is the number of FilesV2 keys loaded at once by the snapshot bootstrap
+const snapshotPageSize = 200
+
 type fetcher struct {
 	initBlock  uint64
 	startBlock uint64
+	store      db.Store
 	log        log15.Logger
 	stop       <-chan int
 	completeCh chan int
 	segfs      []*segFetcher
+	snapshot   bool // load Market.FilesV2 at initBlock instead of replaying the segments
+	conn       *connection
+	initHash   *types.Hash
 }
 
-func NewFetcher(connections [3]*connection, cfg config.ChainConfig, startBlock uint64, logger log15.Logger, stop <-chan int) *fetcher {
-	initBlock := cfg.StartBlock
+func NewFetcher(connections [3]*connection, cfg config.ChainConfig, store db.Store, startBlock uint64, logger log15.Logger, stop <-chan int) *fetcher {
 	hash := fetchInit(connections[0], cfg.StartBlock)
+	snapshot := cfg.Bootstrap == config.BootstrapSnapshot
+	var segfs []*segFetcher
+	if !snapshot {
+		segfs = newSegFetchers(connections, cfg, store, logger, hash, stop)
+	}
+	return &fetcher{
+		cfg.StartBlock,
+		startBlock,
+		store,
+		logger,
+		stop,
+		make(chan int),
+		segfs,
+		snapshot,
+		connections[2],
+		hash,
+	}
+}
+
+// newSegFetchers splits [ZeroNumber, StartBlock] into segments of Size blocks
+func newSegFetchers(connections [3]*connection, cfg config.ChainConfig, store db.Store, logger log15.Logger, hash *types.Hash, stop <-chan int) []*segFetcher {
+	initBlock := cfg.StartBlock
 	segfs := make([]*segFetcher, 0, 100)
 	start := cfg.ZeroNumber
 	end := start + cfg.Size - 1
@@ -33,23 +61,14 @@ func NewFetcher(connections [3]*connection, cfg config.ChainConfig, startBlock u
 		end = initBlock
 	}
 	for end < initBlock {
-		segfs = append(segfs, newSegFetcher(connections, start, end, logger, hash, stop, cfg.UpdateSize))
+		segfs = append(segfs, newSegFetcher(connections, store, start, end, logger, hash, stop, cfg.UpdateSize))
 		start = end + 1
 		end = start + cfg.Size - 1
 	}
 	if end > initBlock {
 		end = initBlock + 1
 	}
-	segfs = append(segfs, newSegFetcher(connections, start, end, logger, hash, stop, cfg.UpdateSize))
-
-	return &fetcher{
-		initBlock,
-		startBlock,
-		logger,
-		stop,
-		make(chan int),
-		segfs,
-	}
+	return append(segfs, newSegFetcher(connections, store, start, end, logger, hash, stop, cfg.UpdateSize))
 }
 
 func (f *fetcher) start() {
@@ -57,6 +76,16 @@ func (f *fetcher) start() {
 		f.complete()
 		return
 	}
+	if f.snapshot {
+		err := f.loadSnapshot()
+		if err != nil {
+			f.log.Error("Load snapshot failed", "err", err)
+			return
+		}
+		f.rebuildFileStats()
+		f.complete()
+		return
+	}
 	var wg sync.WaitGroup
 	wg.Add(len(f.segfs))
 	for _, segf := range f.segfs {
@@ -64,12 +93,81 @@ func (f *fetcher) start() {
 		time.Sleep(time.Second)
 	}
 	wg.Wait()
+	f.rebuildFileStats()
 	f.complete()
 }
 
+// rebuildFileStats fills the file stat rollups from the fetched files, the listener keeps them up to date afterwards
+func (f *fetcher) rebuildFileStats() {
+	for {
+		err := f.store.RebuildFileStats()
+		if err == nil {
+			return
+		}
+		f.log.Error("Failed to rebuild file stats", "err", err)
+		select {
+		case <-f.stop:
+			return
+		case <-time.After(BlockRetryInterval):
+		}
+	}
+}
+
+// loadSnapshot saves every Market.FilesV2 entry at initBlock, it resumes after the key saved in check_point
+func (f *fetcher) loadSnapshot() error {
+	startKey, loaded, err := f.store.GetStorageKey(f.initBlock)
+	if err != nil {
+		return err
+	}
+	f.log.Info("load snapshot", "block", f.initBlock, "loaded", loaded)
+	for {
+		select {
+		case <-f.stop:
+			return errors.New("fetcher terminated")
+		default:
+		}
+		keys, err := f.conn.GetKeyPaged(FileV2Prefix, snapshotPageSize, startKey, f.initHash)
+		if err != nil {
+			f.log.Error("Failed to fetch file keys", "startKey", startKey, "err", err)
+			time.Sleep(BlockRetryInterval)
+			continue
+		}
+		if len(keys) == 0 {
+			f.log.Info("load snapshot done", "block", f.initBlock, "loaded", loaded)
+			return nil
+		}
+		files, err := f.conn.GetFilesInfoV2ListWithKeys(keys, f.initHash)
+		if err != nil {
+			f.log.Error("Failed to fetch files", "startKey", startKey, "err", err)
+			time.Sleep(BlockRetryInterval)
+			continue
+		}
+		dtos := make([]*db.FileInfo, 0, len(files))
+		for _, file := range files {
+			// CreateAt is derived from the expiry and the replicas
+			dtos = append(dtos, file.File.ToFileDto(file.Cid, 0))
+		}
+		lastKey := keys[len(keys)-1]
+		err = f.store.Transaction(func(tx db.Store) error {
+			if err := tx.UpdateReplicasBatch(dtos); err != nil {
+				return err
+			}
+			return tx.UpdateStorageKey(lastKey, loaded+uint64(len(dtos)), f.initBlock)
+		})
+		if err != nil {
+			f.log.Error("Failed to save files", "startKey", startKey, "err", err)
+			time.Sleep(BlockRetryInterval)
+			continue
+		}
+		startKey = lastKey
+		loaded += uint64(len(dtos))
+		f.log.Info("load snapshot progress", "loaded", loaded)
+	}
+}
+
 func fetchInit(conn *connection, endBlock uint64) *types.Hash {
 	for {
-		hash, err := conn.api.RPC.Chain.GetBlockHash(endBlock)
+		hash, err := conn.getApi().RPC.Chain.GetBlockHash(endBlock)
 		if err != nil {
 			time.Sleep(BlockRetryInterval)
 			continue
@@ -90,12 +188,12 @@ func (f *fetcher) getCompleteCh() chan int {
 
 type segFetcher struct {
 	conn       [3]*connection
+	store      db.Store
 	index      uint64
 	end        uint64
 	log        log15.Logger
 	stop       <-chan int
 	initHash   *types.Hash
-	meta       *types.Metadata
 	hashCh     chan *fileMeta
 	fmCh       chan *fileMeta
 	updateSize uint64
@@ -104,11 +202,12 @@ type segFetcher struct {
 type fileMeta struct {
 	blockNumber uint64
 	hash        types.Hash
+	timestamp   int64
 	cids        []string
 }
 
-func newSegFetcher(connection [3]*connection, index uint64, end uint64, logger log15.Logger, hash *types.Hash, stop <-chan int, updateSize uint64) *segFetcher {
-	val, err := db.GetOrInit(index, end)
+func newSegFetcher(connection [3]*connection, store db.Store, index uint64, end uint64, logger log15.Logger, hash *types.Hash, stop <-chan int, updateSize uint64) *segFetcher {
+	val, err := store.GetOrInit(index, end)
 	if err != nil {
 		panic(err)
 	}
@@ -116,12 +215,12 @@ func newSegFetcher(connection [3]*connection, index uint64, end uint64, logger l
 	logger.Info("seg fetcher ", "start", index, "end", end)
 	return &segFetcher{
 		connection,
+		store,
 		index,
 		end,
 		logger,
 		stop,
 		hash,
-		nil,
 		make(chan *fileMeta, 10),
 		make(chan *fileMeta, 10),
 		updateSize,
@@ -160,22 +259,6 @@ func (s *segFetcher) start(wg *sync.WaitGroup) {
 
 func (s *segFetcher) fetchHash(conn *connection) error {
 	indexNumber := s.index
-	for {
-		h, err := conn.api.RPC.Chain.GetBlockHash(indexNumber)
-		if err != nil {
-			s.log.Error("failed to get init block hash", "err", err)
-			time.Sleep(time.Second)
-			continue
-		}
-		meta, err := conn.api.RPC.State.GetMetadata(h)
-		if err != nil {
-			s.log.Error("failed to get init meta", "err", err)
-			time.Sleep(time.Second)
-			continue
-		}
-		s.meta = meta
-		break
-	}
 	s.log.Info("seg fetcher complete  init", "end", s.end)
 Main:
 	for {
@@ -185,7 +268,7 @@ Main:
 		default:
 			// Get hash for index block, sleep and retry if not ready
 			//now := time.Now().UnixMilli()
-			hash, err := conn.api.RPC.Chain.GetBlockHash(indexNumber)
+			hash, err := conn.getApi().RPC.Chain.GetBlockHash(indexNumber)
 			//after := time.Now().UnixMilli()
 			//f.log.Info("hash", "escape", after-now)
 			if err != nil {
@@ -239,12 +322,16 @@ main:
 
 func (s *segFetcher) processEvents(fm *fileMeta, conn *connection) error {
 	//now := time.Now().UnixMilli()
-	evts, err := conn.GetEvents(s.meta, &fm.hash)
+	evts, err := conn.GetEvents(&fm.hash)
 	//after := time.Now().UnixMilli()
 	//f.log.Info("event", "escape", after-now)
 	if err != nil {
 		return err
 	}
+	fm.timestamp, err = conn.GetTimestampAt(&fm.hash)
+	if err != nil {
+		return err
+	}
 	if len(evts.Market_FileSuccess) > 0 {
 		cids := make([]string, 0, len(evts.Market_FileSuccess))
 		for _, evt := range evts.Market_FileSuccess {
@@ -258,14 +345,6 @@ func (s *segFetcher) processEvents(fm *fileMeta, conn *connection) error {
 		fm.cids = cids
 	}
 	s.fmCh <- fm
-	if len(evts.System_CodeUpdated) > 0 {
-		s.log.Trace("Received CodeUpdated event")
-		meta, err := conn.api.RPC.State.GetMetadata(fm.hash)
-		if err != nil {
-			s.log.Error("Unable to update Metadata", "err", err)
-		}
-		s.meta = meta
-	}
 
 	s.log.Trace("Finished processing events", "block", fm.hash.Hex())
 	return nil
@@ -273,6 +352,7 @@ func (s *segFetcher) processEvents(fm *fileMeta, conn *connection) error {
 
 func (s *segFetcher) saveFiles(conn *connection) error {
 	nextUpdate := uint64(0)
+	times := make([]db.BlockTime, 0, s.updateSize)
 main:
 	for {
 		select {
@@ -282,8 +362,16 @@ main:
 			// Get hash for index block, sleep and retry if not ready
 			if ok {
 				s.saveKeys(fm, conn)
+				times = append(times, db.BlockTime{BlockNumber: fm.blockNumber, Timestamp: fm.timestamp})
 				if fm.blockNumber >= nextUpdate || fm.blockNumber == s.end {
-					db.UpdateIndexKey(fm.blockNumber, s.end)
+					// block times are saved with the index key, a restart fetches the unsaved ones again
+					err := s.store.SaveBlockTimes(times)
+					if err != nil {
+						s.log.Error("save block times error", "number", fm.blockNumber, "err", err)
+						continue
+					}
+					times = times[:0]
+					s.store.UpdateIndexKey(fm.blockNumber, s.end)
 					nextUpdate = fm.blockNumber + s.updateSize
 				}
 			} else {
@@ -309,14 +397,16 @@ func (s *segFetcher) saveKeys(fm *fileMeta, conn *connection) {
 			dbFile := file.File.ToFileDto(file.Cid, uint32(fm.blockNumber))
 			retry := RetryCnt
 			for {
-				err = db.SaveFiles(dbFile, false)
+				err = s.store.SaveFiles(dbFile, false)
 				if err != nil {
 					retry--
 					s.log.Error("save fileInfoV2 error", "cid", file.Cid, "err", err)
 					if retry <= 0 {
-						err = db.SaveError(&db.ErrorFile{
-							Cid: file.Cid,
-							Key: file.Key,
+						err = s.store.SaveError(&db.ErrorFile{
+							Cid:         file.Cid,
+							Key:         file.Key,
+							BlockNumber: fm.blockNumber,
+							LastError:   err.Error(),
 						})
 						if err == nil {
 							break
@@ -2,6 +2,9 @@ package chain
 
 import (
 	"statistic/db"
+
+	events "github.com/crustio/chainbridge-substrate-events"
+	"github.com/crustio/go-substrate-rpc-client/v4/types"
 )
 
 const (
@@ -9,23 +12,139 @@ const (
 	UpdateBase
 	UpdateRep
 	Delete
+	IllegalDelete
 )
 
-func saveNewFile(fileInfo *FileInfoV2, cid string, number uint64) error {
+func init() {
+	RegisterEventHandler("Market_RenewFileSuccess", "Market", "RenewFileSuccess", handleRenewFile)
+	RegisterEventHandler("Market_UpdateReplicasSuccess", "Market", "UpdateReplicasSuccess", handleUpdateReplicas)
+	RegisterEventHandler("Swork_WorksReportSuccess", "Swork", "WorksReportSuccess", handleWorksReport)
+	RegisterEventHandler("Swork_UpdateSpowerSuccess", "Swork", "UpdateSpowerSuccess", handleUpdateSpower)
+	RegisterEventHandler("Market_CalculateSpowersSuccess", "Market", "CalculateSpowersSuccess", handleCalculateSpowers)
+	RegisterEventHandler("Market_FileSuccess", "Market", "FileSuccess", handleFileSuccess)
+	RegisterEventHandler("Market_IllegalFileClosed", "Market", "IllegalFileClosed", handleIllegalFileClosed)
+	RegisterEventHandler("Market_FileClosed", "Market", "FileClosed", handleFileClosed)
+	RegisterEventHandler("ReplicaEvents", "Swork", "WorksReportSuccess", handleReplicaEvents)
+	RegisterEventHandler("FileRenewals", "Market", "RenewFileSuccess", handleFileRenewals)
+}
+
+func handleRenewFile(ctx *BlockContext, evt interface{}) error {
+	ctx.AddOp(string(evt.(events.EventRenewFileSuccess).Cid), UpdateBase)
+	return nil
+}
+
+func handleUpdateReplicas(ctx *BlockContext, evt interface{}) error {
+	return setOpFromExtrinsic(ctx, evt.(events.EventUpdateReplicasSuccess).Phase, decodeCidsFromBlock)
+}
+
+func handleWorksReport(ctx *BlockContext, evt interface{}) error {
+	return setOpFromExtrinsic(ctx, evt.(events.EventWorksReportSuccess).Phase, decodeCidsFromSworkReport)
+}
+
+func handleUpdateSpower(ctx *BlockContext, evt interface{}) error {
+	return setOpFromExtrinsic(ctx, evt.(events.EventUpdateSpowerSuccess).Phase, decodeCidsFromUpdateSpower)
+}
+
+func handleCalculateSpowers(ctx *BlockContext, evt interface{}) error {
+	return setOpFromExtrinsic(ctx, evt.(events.EventCalculateSpowersSuccess).Phase, decodeCidsFromCalculateSpowersSuccess)
+}
+
+func handleFileSuccess(ctx *BlockContext, evt interface{}) error {
+	cid := string(evt.(events.EventFileSuccess).Cid)
+	ctx.SetOp(cid, New)
+	ctx.AddFileOrder(cid)
+	return nil
+}
+
+func handleIllegalFileClosed(ctx *BlockContext, evt interface{}) error {
+	ctx.SetOp(string(evt.(events.EventIllegalFileClosed).Cid), IllegalDelete)
+	return nil
+}
+
+func handleFileClosed(ctx *BlockContext, evt interface{}) error {
+	ctx.SetOp(string(evt.(events.EventFileClosed).Cid), Delete)
+	return nil
+}
+
+// handleReplicaEvents records every file added or deleted by the work report
+func handleReplicaEvents(ctx *BlockContext, evt interface{}) error {
+	e := evt.(events.EventWorksReportSuccess)
+	block, err := ctx.Block()
+	if err != nil {
+		return err
+	}
+	replicaEvents, err := decodeReplicaEventsFromSworkReport(block, int(e.Phase.AsApplyExtrinsic), encodeAccount(e.Who[:]), ctx.Number)
+	if err != nil {
+		return err
+	}
+	ctx.replicaEvents = append(ctx.replicaEvents, replicaEvents...)
+	return nil
+}
+
+// handleFileRenewals marks the file for a renewal record, the file base is updated by Market_RenewFileSuccess
+func handleFileRenewals(ctx *BlockContext, evt interface{}) error {
+	ctx.renewedCids = append(ctx.renewedCids, string(evt.(events.EventRenewFileSuccess).Cid))
+	return nil
+}
+
+// setOpFromExtrinsic decodes the cids of the extrinsic that emitted the event and marks their replicas for update
+func setOpFromExtrinsic(ctx *BlockContext, phase types.Phase, decode func(*types.SignedBlock, int) ([]string, error)) error {
+	block, err := ctx.Block()
+	if err != nil {
+		return err
+	}
+	cids, err := decode(block, int(phase.AsApplyExtrinsic))
+	if err != nil {
+		return err
+	}
+	for _, cid := range cids {
+		ctx.SetOp(cid, UpdateRep)
+	}
+	return nil
+}
+
+func saveNewFile(store db.Store, fileInfo *FileInfoV2, cid string, number uint64) error {
 	file := fileInfo.ToFileDto(cid, uint32(number))
-	return db.SaveFiles(file, true)
+	return store.SaveFiles(file, true)
 }
 
-func updateFileBase(fileInfo *FileInfoV2, cid string) error {
+func updateFileBase(store db.Store, fileInfo *FileInfoV2, cid string) error {
 	file := fileInfo.ToFileSingleDto(cid)
-	return db.UpdateFile(file)
+	return store.UpdateFile(file)
+}
+
+// updateReplicasBatch saves the replicas of every file updated in a block at once
+func updateReplicasBatch(store db.Store, files []*StorageFile) error {
+	dtos := make([]*db.FileInfo, 0, len(files))
+	for _, file := range files {
+		dtos = append(dtos, file.File.ToFileDto(file.Cid, 0))
+	}
+	return store.UpdateReplicasBatch(dtos)
 }
 
-func updateReplicas(fileInfo *FileInfoV2, cid string) error {
-	file := fileInfo.ToFileDto(cid, 0)
-	return db.UpdateReplicas(file)
+// fileRenewal compares the file before the renewal with the renewed one, old is nil if the file was not on chain
+func fileRenewal(old *FileInfoV2, fileInfo *FileInfoV2, cid string, number uint64) *db.FileRenewal {
+	renewal := &db.FileRenewal{
+		Cid:          cid,
+		BlockNumber:  number,
+		FileSize:     fileInfo.FileSize,
+		NewExpiredAt: fileInfo.ExpiredAt,
+		AmountDelta:  balanceDelta("0", fileInfo.Amount),
+		PrepaidDelta: balanceDelta("0", fileInfo.Prepaid),
+	}
+	if old != nil {
+		renewal.OldExpiredAt = old.ExpiredAt
+		renewal.AmountDelta = balanceDelta(old.Amount, fileInfo.Amount)
+		renewal.PrepaidDelta = balanceDelta(old.Prepaid, fileInfo.Prepaid)
+	}
+	return renewal
 }
 
-func deleteByCid(cid string) error {
-	return db.DeleteByCid(cid)
+// closeByCid archives the file closed at block number, op is Delete or IllegalDelete
+func closeByCid(store db.Store, cid string, op int, number uint64) error {
+	reason := db.CloseReasonClosed
+	if op == IllegalDelete {
+		reason = db.CloseReasonIllegal
+	}
+	return store.CloseByCid(cid, number, reason)
 }
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/ChainSafe/log15"
+	rpcchain "github.com/crustio/go-substrate-rpc-client/v4/rpc/chain"
 	"github.com/crustio/go-substrate-rpc-client/v4/types"
 )
 
@@ -13,23 +14,44 @@ const BlockRetryInterval = time.Second * 5
 
 type listener struct {
 	conn       *connection
+	store      db.Store
 	startBlock uint64
 	confirm    uint64
 	log        log15.Logger
 	stop       <-chan int
 	completeCh <-chan int
-	useMarket  bool
+	handlers   []*eventHandler
+	checkpoint bool // Whether to move the IndexBlockNumber checkpoint after each block
+	stats      FileStats
+	feed       *ChangeFeed // receives the changes of every committed block, nil to disable
+	// only rebuild the block history tables, file_info and replica keep the current state
+	historyOnly bool
 }
 
-func NewListener(connection *connection, startBlock uint64, confirm uint64, logger log15.Logger, stop <-chan int, completeCh <-chan int, useMarket bool) *listener {
+// FileStats counts the file changes applied by the listener
+type FileStats struct {
+	Created int
+	Updated int
+	Deleted int
+}
+
+func (s *FileStats) add(o FileStats) {
+	s.Created += o.Created
+	s.Updated += o.Updated
+	s.Deleted += o.Deleted
+}
+
+func NewListener(connection *connection, store db.Store, startBlock uint64, confirm uint64, logger log15.Logger, stop <-chan int, completeCh <-chan int, handlers []*eventHandler) *listener {
 	return &listener{
-		connection,
-		startBlock,
-		confirm,
-		logger,
-		stop,
-		completeCh,
-		useMarket,
+		conn:       connection,
+		store:      store,
+		startBlock: startBlock,
+		confirm:    confirm,
+		log:        logger,
+		stop:       stop,
+		completeCh: completeCh,
+		handlers:   handlers,
+		checkpoint: true,
 	}
 }
 
@@ -39,9 +61,9 @@ func (l *listener) start() {
 		if err != nil {
 			return
 		}
-		err = l.pollBlocks()
+		err = l.listenBlocks()
 		if err != nil {
-			l.log.Error("Pool block failed", "err", err)
+			l.log.Error("Listen block failed", "err", err)
 		}
 	}()
 
@@ -50,7 +72,7 @@ func (l *listener) start() {
 func (l *listener) waitFetchComplete() error {
 	select {
 	case <-l.stop:
-		return errors.New("listener terminated")
+		return ErrListenerTerminated
 	case <-l.completeCh:
 		return nil
 	}
@@ -58,77 +80,132 @@ func (l *listener) waitFetchComplete() error {
 
 var ErrBlockNotReady = errors.New("required result to be 32 bytes, but got 0")
 
-func (l *listener) pollBlocks() error {
-	var currentBlock = l.startBlock
-	var finalizedHeader *types.Header
+var ErrListenerTerminated = errors.New("listener terminated")
+
+// SubscribeRetryInterval is how long the listener keeps polling before it tries to subscribe again
+const SubscribeRetryInterval = time.Minute
+
+// listenBlocks follows the finalized heads subscription and falls back to polling while it is unavailable
+func (l *listener) listenBlocks() error {
 	for {
+		sub, err := l.conn.getApi().RPC.Chain.SubscribeFinalizedHeads()
+		if err != nil {
+			l.log.Error("Failed to subscribe finalized heads, fallback to polling", "err", err)
+			err = l.pollBlocks(time.Now().Add(SubscribeRetryInterval))
+		} else {
+			err = l.followHeads(sub)
+		}
+		if err != nil {
+			return err
+		}
+		// the subscription dropped, give the node some time before subscribing again
 		select {
 		case <-l.stop:
-			return errors.New("terminated")
-		default:
-			// No more retries, goto next block
-			if finalizedHeader == nil || uint64(finalizedHeader.Number)-currentBlock < l.confirm {
-				// Get finalized block hash
-				finalizedHash, err := l.conn.api.RPC.Chain.GetFinalizedHead()
-				if err != nil {
-					l.log.Error("Failed to fetch finalized hash", "err", err)
-					time.Sleep(BlockRetryInterval)
-					continue
-				}
+			return ErrListenerTerminated
+		case <-time.After(BlockRetryInterval):
+		}
+	}
+}
 
-				// Get finalized block header
-				finalizedHeader, err = l.conn.api.RPC.Chain.GetHeader(finalizedHash)
-				if err != nil {
-					l.log.Error("Failed to fetch finalized header", "err", err)
-					time.Sleep(BlockRetryInterval)
-					continue
-				}
+// followHeads processes blocks whenever a new finalized header arrives, returns nil if the subscription drops
+func (l *listener) followHeads(sub *rpcchain.FinalizedHeadsSubscription) error {
+	defer sub.Unsubscribe()
+	l.log.Info("Subscribed finalized heads", "current", l.startBlock)
+	for {
+		select {
+		case <-l.stop:
+			return ErrListenerTerminated
+		case err := <-sub.Err():
+			l.log.Warn("Finalized heads subscription dropped", "err", err)
+			return nil
+		case header, ok := <-sub.Chan():
+			if !ok {
+				l.log.Warn("Finalized heads subscription closed")
+				return nil
 			}
-
-			// Sleep if the block we want comes after the most recently finalized block
-			if currentBlock > uint64(finalizedHeader.Number) {
-				l.log.Trace("Block not yet finalized", "target", currentBlock, "latest", finalizedHeader.Number)
-				time.Sleep(BlockRetryInterval)
-				continue
+			err := l.processUntil(uint64(header.Number))
+			if err == ErrListenerTerminated {
+				return err
 			}
+		}
+	}
+}
 
-			// Sleep if the difference is less than BlockDelay; (latest - current) < BlockDelay
-			if uint64(finalizedHeader.Number)-currentBlock < l.confirm {
-				l.log.Debug("Block not ready, will retry", "target", currentBlock, "latest", finalizedHeader.Number, "delay", l.confirm)
+// pollBlocks polls the finalized head until deadline, it is only used when the subscription is unavailable
+func (l *listener) pollBlocks(deadline time.Time) error {
+	for time.Now().Before(deadline) {
+		select {
+		case <-l.stop:
+			return ErrListenerTerminated
+		default:
+			// Get finalized block hash
+			finalizedHash, err := l.conn.getApi().RPC.Chain.GetFinalizedHead()
+			if err != nil {
+				l.log.Error("Failed to fetch finalized hash", "err", err)
 				time.Sleep(BlockRetryInterval)
 				continue
 			}
 
-			// Get hash for latest block, sleep and retry if not ready
-			hash, err := l.conn.api.RPC.Chain.GetBlockHash(currentBlock)
-			if err != nil && err.Error() == ErrBlockNotReady.Error() {
-				time.Sleep(BlockRetryInterval)
-				continue
-			} else if err != nil {
-				l.log.Error("Failed to query block", "block", currentBlock, "err", err)
+			// Get finalized block header
+			finalizedHeader, err := l.conn.getApi().RPC.Chain.GetHeader(finalizedHash)
+			if err != nil {
+				l.log.Error("Failed to fetch finalized header", "err", err)
 				time.Sleep(BlockRetryInterval)
 				continue
 			}
-			l.log.Info("process block", "number", currentBlock)
-			err = l.processEvents(&hash, currentBlock)
-			if err != nil {
-				l.log.Error("Failed to process events in block", "block", currentBlock, "err", err)
-				continue
+
+			err = l.processUntil(uint64(finalizedHeader.Number))
+			if err == ErrListenerTerminated {
+				return err
 			}
-			// Write block index
-			currentBlock++
-			l.startBlock = currentBlock
+			time.Sleep(BlockRetryInterval)
+		}
+	}
+	return nil
+}
+
+// processUntil processes every block that is at least confirm blocks behind the finalized block
+func (l *listener) processUntil(finalized uint64) error {
+	for l.startBlock+l.confirm <= finalized {
+		select {
+		case <-l.stop:
+			return ErrListenerTerminated
+		default:
+		}
+		currentBlock := l.startBlock
+		// Get hash for current block, retry on the next head if not ready
+		hash, err := l.conn.getApi().RPC.Chain.GetBlockHash(currentBlock)
+		if err != nil && err.Error() == ErrBlockNotReady.Error() {
+			return err
+		} else if err != nil {
+			l.log.Error("Failed to query block", "block", currentBlock, "err", err)
+			return err
 		}
+		l.log.Info("process block", "number", currentBlock)
+		err = l.processEvents(&hash, currentBlock)
+		if err != nil {
+			l.log.Error("Failed to process events in block", "block", currentBlock, "err", err)
+			return err
+		}
+		// Write block index
+		l.startBlock = currentBlock + 1
 	}
+	l.log.Trace("Block not ready", "target", l.startBlock, "latest", finalized, "delay", l.confirm)
+	return nil
 }
 
-// processEvents fetches a block and parses out the events, calling listener.handleEvents()
+// processEvents fetches the events and the timestamp of a block and parses out the events, calling listener.handleEvents()
 func (l *listener) processEvents(hash *types.Hash, number uint64) error {
-	events, err := l.conn.GetEvents(l.conn.getMetadata(), hash)
+	events, err := l.conn.GetEvents(hash)
+	if err != nil {
+		return err
+	}
+	ctx := newBlockContext(l.conn, hash, number)
+	ctx.Timestamp, err = l.conn.GetTimestampAt(hash)
 	if err != nil {
 		return err
 	}
-	err = l.handleEvents(events, hash, number)
+	err = l.handleEvents(events, ctx)
 	if err != nil {
 		return err
 	}
@@ -136,137 +213,162 @@ func (l *listener) processEvents(hash *types.Hash, number uint64) error {
 	return nil
 }
 
-// handleEvents calls the associated handler for all registered event types
-func (l *listener) handleEvents(evts *Events, hash *types.Hash, number uint64) error {
-	result := make(map[string]int)
-	fileOrders := make([]db.FileOrder, 0, 10)
-	var err error
+// handleEvents dispatches the events to the registered handlers and applies the collected changes.
+// All database changes of the block are committed together with the checkpoint, so a failed block can be replayed.
+// The history rows of the block are replaced rather than appended, so a replayed block does not duplicate them.
+func (l *listener) handleEvents(evts *Events, ctx *BlockContext) error {
+	number := ctx.Number
+	err := dispatchEvents(l.handlers, evts, ctx)
+	if err != nil {
+		return err
+	}
 
-	for _, evt := range evts.Market_RenewFileSuccess {
-		if _, ok := result[string(evt.Cid)]; !ok {
-			result[string(evt.Cid)] = UpdateBase
+	cidMap := make(map[string]*StorageFile)
+	if !l.historyOnly {
+		cidMap, err = l.fetchFiles(ctx)
+		if err != nil {
+			return err
 		}
 	}
 
-	var block *types.SignedBlock
-	if l.useMarket {
-		for _, evt := range evts.Market_UpdateReplicasSuccess {
-			if block == nil {
-				block, err = l.conn.GetBlock(hash)
-				if err != nil {
-					return err
-				}
-			}
-			cids, err := decodeCidsFromBlock(block, int(evt.Phase.AsApplyExtrinsic))
-			if err != nil {
-				return err
-			}
-			for _, cid := range cids {
-				result[cid] = UpdateRep
-			}
-		}
-	} else {
-		for _, evt := range evts.Swork_WorksReportSuccess {
-			if block == nil {
-				block, err = l.conn.GetBlock(hash)
-				if err != nil {
-					return err
-				}
-			}
-			cids, err := decodeCidsFromSworkReport(block, int(evt.Phase.AsApplyExtrinsic))
-			if err != nil {
-				return err
-			}
-			for _, cid := range cids {
-				result[cid] = UpdateRep
-			}
-		}
+	err = l.fileRenewals(ctx, cidMap)
+	if err != nil {
+		return err
 	}
 
-	for _, evt := range evts.Swork_UpdateSpowerSuccess {
-		if block == nil {
-			block, err = l.conn.GetBlock(hash)
+	var stats FileStats
+	err = l.store.Transaction(func(tx db.Store) error {
+		stats = FileStats{}
+		if l.historyOnly {
+			stats = opStats(ctx.ops)
+		} else {
+			//update files with Cids
+			err := l.updateFiles(tx, ctx, cidMap, &stats)
 			if err != nil {
 				return err
 			}
 		}
-		cids, err := decodeCidsFromUpdateSpower(block, int(evt.Phase.AsApplyExtrinsic))
+
+		err = tx.ReplaceFileOrders(number, ctx.fileOrders)
 		if err != nil {
 			return err
 		}
-		for _, cid := range cids {
-			result[cid] = UpdateRep
+
+		err = tx.ReplaceReplicaEvents(number, ctx.replicaEvents)
+		if err != nil {
+			return err
 		}
-	}
 
-	for _, evt := range evts.Market_CalculateSpowersSuccess {
-		if block == nil {
-			block, err = l.conn.GetBlock(hash)
-			if err != nil {
-				return err
-			}
+		err = tx.ReplaceFileRenewals(number, ctx.renewals)
+		if err != nil {
+			return err
 		}
-		cids, err := decodeCidsFromCalculateSpowersSuccess(block, int(evt.Phase.AsApplyExtrinsic))
+
+		err = tx.SaveBlockTimes([]db.BlockTime{{BlockNumber: number, Timestamp: ctx.Timestamp}})
 		if err != nil {
 			return err
 		}
-		for _, cid := range cids {
-			result[cid] = UpdateRep
+
+		if !l.checkpoint {
+			return nil
 		}
+		return tx.UpdateBlockNumber(number)
+	})
+	if err != nil {
+		return err
 	}
-
-	for _, evt := range evts.Market_FileSuccess {
-		result[string(evt.Cid)] = New
-		fileOrders = append(fileOrders, db.FileOrder{
-			Cid:         string(evt.Cid),
-			BlockNumber: number,
-		})
+	l.stats.add(stats)
+	if l.feed != nil {
+		l.feed.Publish(blockChanges(ctx, cidMap))
 	}
+	return nil
+}
 
-	for _, evt := range evts.Market_IllegalFileClosed {
-		result[string(evt.Cid)] = Delete
+// opStats counts the file changes of a block without applying them
+func opStats(ops map[string]int) FileStats {
+	var stats FileStats
+	for _, op := range ops {
+		switch op {
+		case New:
+			stats.Created++
+		case UpdateBase, UpdateRep:
+			stats.Updated++
+		case Delete, IllegalDelete:
+			stats.Deleted++
+		}
 	}
+	return stats
+}
 
-	for _, evt := range evts.Market_FileClosed {
-		result[string(evt.Cid)] = Delete
-	}
-	//update files with Cids
-	if len(result) > 0 {
-		err = l.updateFiles(result, hash, number)
-		if err != nil {
-			return err
+// fetchFiles queries the files of every changed cid that is not closed at the block
+func (l *listener) fetchFiles(ctx *BlockContext) (map[string]*StorageFile, error) {
+	cids := make([]string, 0, len(ctx.ops))
+	for key, op := range ctx.ops {
+		if op != Delete && op != IllegalDelete {
+			cids = append(cids, key)
 		}
 	}
 
-	db.SaveFileOrders(fileOrders)
-
-	if len(evts.System_CodeUpdated) > 0 {
-		l.log.Trace("Received CodeUpdated event")
-		err := l.conn.updateMetadata(hash)
-		if err != nil {
-			l.log.Error("Unable to update Metadata", "error", err)
-		}
+	cidMap := make(map[string]*StorageFile)
+	if len(cids) == 0 {
+		return cidMap, nil
+	}
+	files, err := l.conn.GetFilesInfoV2ListWithCids(cids, ctx.Hash)
+	if err != nil {
+		return nil, err
 	}
+	for _, file := range files {
+		cidMap[file.Cid] = file
+	}
+	return cidMap, nil
+}
 
-	err = db.UpdateBlockNumber(number)
+// closedAccounts saves the replica accounts of the files closed in the block into ctx
+func closedAccounts(store db.Store, ctx *BlockContext, cids []string) error {
+	ctx.closedAccounts = make(map[string][]string, len(cids))
+	if len(cids) == 0 {
+		return nil
+	}
+	files, err := store.QueryFilesByCids(cids)
 	if err != nil {
 		return err
 	}
-
+	ids := make([]int, 0, len(files))
+	for _, f := range files {
+		ids = append(ids, f.ID)
+	}
+	replicas, err := store.ReplicasByFileIds(ids)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		ctx.closedAccounts[f.Cid] = savedReplicaAccounts(replicas[f.ID])
+	}
 	return nil
 }
 
-func (l *listener) updateFiles(ops map[string]int, hash *types.Hash, number uint64) error {
-	cids := make([]string, 0, len(ops))
-	for key, op := range ops {
-		if op != Delete {
-			cids = append(cids, key)
+// fileRenewals compares every renewed file with its chain state at the parent block, i.e. right before the renewal.
+// The renewed files missing in cidMap are fetched at the block and added to it, files closed in the block are skipped.
+func (l *listener) fileRenewals(ctx *BlockContext, cidMap map[string]*StorageFile) error {
+	ctx.renewals = ctx.renewals[:0]
+	if len(ctx.renewedCids) == 0 {
+		return nil
+	}
+	seen := make(map[string]bool, len(ctx.renewedCids))
+	cids := make([]string, 0, len(ctx.renewedCids))
+	missing := make([]string, 0)
+	for _, cid := range ctx.renewedCids {
+		if seen[cid] {
+			continue
+		}
+		seen[cid] = true
+		cids = append(cids, cid)
+		if _, ok := cidMap[cid]; !ok {
+			missing = append(missing, cid)
 		}
 	}
-
-	cidMap := make(map[string]*StorageFile)
-	if len(cids) > 0 {
-		files, err := l.conn.GetFilesInfoV2ListWithCids(cids, hash)
+	if len(missing) > 0 {
+		files, err := l.conn.GetFilesInfoV2ListWithCids(missing, ctx.Hash)
 		if err != nil {
 			return err
 		}
@@ -274,32 +376,78 @@ func (l *listener) updateFiles(ops map[string]int, hash *types.Hash, number uint
 			cidMap[file.Cid] = file
 		}
 	}
-	var err error
-	for cid, t := range ops {
-		l.log.Info("handler file", "type", t, "cid", cid)
-		//println(cid)
-		switch t {
-		case New:
-			file, ok := cidMap[cid]
-			if ok {
-				err = saveNewFile(file.File, file.Cid, number)
-			}
-		case UpdateBase:
-			file, ok := cidMap[cid]
-			if ok {
-				err = updateFileBase(file.File, file.Cid)
-			}
-		case UpdateRep:
-			file, ok := cidMap[cid]
-			if ok {
-				err = updateReplicas(file.File, file.Cid)
-			}
-		case Delete:
-			err = deleteByCid(cid)
-		}
-		if err != nil {
-			return err
+	block, err := ctx.Block()
+	if err != nil {
+		return err
+	}
+	parentHash := block.Block.Header.ParentHash
+	olds, err := l.conn.GetFilesInfoV2ListWithCids(cids, &parentHash)
+	if err != nil {
+		return err
+	}
+	oldMap := make(map[string]*FileInfoV2, len(olds))
+	for _, old := range olds {
+		oldMap[old.Cid] = old.File
+	}
+	for _, cid := range cids {
+		file, ok := cidMap[cid]
+		if !ok {
+			continue
 		}
+		ctx.renewals = append(ctx.renewals, *fileRenewal(oldMap[cid], file.File, cid, ctx.Number))
 	}
 	return nil
 }
+
+func (l *listener) updateFiles(store db.Store, ctx *BlockContext, cidMap map[string]*StorageFile, stats *FileStats) error {
+	ops, number := ctx.ops, ctx.Number
+	cids := make([]string, 0, len(ops))
+	closed := make([]string, 0)
+	for cid, op := range ops {
+		cids = append(cids, cid)
+		if op == Delete || op == IllegalDelete {
+			closed = append(closed, cid)
+		}
+	}
+	// The replicas of closed files are gone after the update, their accounts are kept for the change feed
+	err := closedAccounts(store, ctx, closed)
+	if err != nil {
+		return err
+	}
+	// The file stat rollups follow the change of every file touched by the block
+	return db.WithFileStats(store, cids, func() error {
+		var err error
+		reps := make([]*StorageFile, 0)
+		for cid, t := range ops {
+			l.log.Info("handler file", "type", t, "cid", cid)
+			//println(cid)
+			switch t {
+			case New:
+				file, ok := cidMap[cid]
+				if ok {
+					err = saveNewFile(store, file.File, file.Cid, number)
+					stats.Created++
+				}
+			case UpdateBase:
+				file, ok := cidMap[cid]
+				if ok {
+					err = updateFileBase(store, file.File, file.Cid)
+					stats.Updated++
+				}
+			case UpdateRep:
+				file, ok := cidMap[cid]
+				if ok {
+					reps = append(reps, file)
+					stats.Updated++
+				}
+			case Delete, IllegalDelete:
+				err = closeByCid(store, cid, t, number)
+				stats.Deleted++
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return updateReplicasBatch(store, reps)
+	})
+}
@@ -0,0 +1,128 @@
+package chain
+
+import (
+	"errors"
+	"statistic/config"
+	"statistic/db"
+	"testing"
+
+	"github.com/ChainSafe/log15"
+	events "github.com/crustio/chainbridge-substrate-events"
+	"github.com/crustio/go-substrate-rpc-client/v4/types"
+	"gotest.tools/assert"
+)
+
+const TestCid = "QmPwJvYX1xdh4PAxhtf6s8X9iqVXDHUFsisaB27BTVvorH"
+
+var errCheckpoint = errors.New("checkpoint failed")
+
+// failCheckpointStore fails the checkpoint update, after every other change of the block is written
+type failCheckpointStore struct {
+	db.Store
+}
+
+func (s failCheckpointStore) Transaction(fn func(tx db.Store) error) error {
+	return s.Store.Transaction(func(tx db.Store) error {
+		return fn(failCheckpointStore{tx})
+	})
+}
+
+func (s failCheckpointStore) UpdateBlockNumber(uint64) error {
+	return errCheckpoint
+}
+
+func newTestListener(t *testing.T, store db.Store) *listener {
+	l := NewListener(nil, store, 0, 0, log15.Root(), nil, nil, enabledEventHandlers(config.ChainConfig{}))
+	// creates the checkpoint like NewChain does
+	_, err := store.GetBlockNumber()
+	assert.NilError(t, err)
+	err = store.InsertFiles(&db.FileInfo{Cid: TestCid, FileSize: 1, Replicas: []db.Replica{{Who: "a"}}})
+	assert.NilError(t, err)
+	assert.NilError(t, store.RebuildFileStats())
+	return l
+}
+
+func closeEvents() *Events {
+	evts := &Events{}
+	evts.Market_FileClosed = []events.EventFileClosed{{Cid: types.NewBytes([]byte(TestCid))}}
+	return evts
+}
+
+func testBlockContext() *BlockContext {
+	ctx := newBlockContext(nil, &types.Hash{}, 10)
+	ctx.Timestamp = 1700000000
+	return ctx
+}
+
+func TestHandleEventsCommitsBlock(t *testing.T) {
+	store, err := db.NewStore(config.DbConfig{Type: db.TypeSqlite, Name: ":memory:"})
+	assert.NilError(t, err)
+	l := newTestListener(t, store)
+
+	err = l.handleEvents(closeEvents(), testBlockContext())
+	assert.NilError(t, err)
+	_, err = store.QueryFileByCid(TestCid)
+	assert.Assert(t, err != nil)
+	bn, err := store.GetBlockNumber()
+	assert.NilError(t, err)
+	assert.Equal(t, bn, uint64(10))
+	assert.Equal(t, l.stats.Deleted, 1)
+	stats, err := store.FileStatSums(db.StatSize, 0, 0)
+	assert.NilError(t, err)
+	assert.Equal(t, len(stats), 0)
+	bt, err := store.BlockTimeAt(10)
+	assert.NilError(t, err)
+	assert.Equal(t, bt.Timestamp, int64(1700000000))
+}
+
+func TestHandleEventsRollsBackBlock(t *testing.T) {
+	store, err := db.NewStore(config.DbConfig{Type: db.TypeSqlite, Name: ":memory:"})
+	assert.NilError(t, err)
+	l := newTestListener(t, failCheckpointStore{store})
+
+	err = l.handleEvents(closeEvents(), testBlockContext())
+	assert.Equal(t, err, errCheckpoint)
+	file, err := store.QueryFileByCid(TestCid)
+	assert.NilError(t, err)
+	assert.Equal(t, file.Cid, TestCid)
+	closed, err := store.ClosedFilesByCid(TestCid)
+	assert.NilError(t, err)
+	assert.Equal(t, len(closed), 0)
+	assert.Equal(t, l.stats.Deleted, 0)
+	_, err = store.BlockTimeAt(10)
+	assert.Assert(t, err != nil)
+	stats, err := store.FileStatSums(db.StatSize, 0, 0)
+	assert.NilError(t, err)
+	assert.Equal(t, len(stats), 1)
+	assert.Equal(t, stats[0].Files, int64(1))
+}
+
+func TestFileRenewal(t *testing.T) {
+	old := &FileInfoV2{FileSize: 100, ExpiredAt: 1000, Amount: "50", Prepaid: "0"}
+	renewed := &FileInfoV2{FileSize: 100, ExpiredAt: 2000, Amount: "80", Prepaid: "10"}
+	renewal := fileRenewal(old, renewed, "QmA", 1500)
+	assert.Equal(t, renewal.OldExpiredAt, uint32(1000))
+	assert.Equal(t, renewal.NewExpiredAt, uint32(2000))
+	assert.Equal(t, renewal.AmountDelta, "30")
+	assert.Equal(t, renewal.PrepaidDelta, "10")
+
+	renewal = fileRenewal(nil, renewed, "QmA", 1500)
+	assert.Equal(t, renewal.OldExpiredAt, uint32(0))
+	assert.Equal(t, renewal.AmountDelta, "80")
+}
+
+func TestHandleEventsPublishesClose(t *testing.T) {
+	store, err := db.NewStore(config.DbConfig{Type: db.TypeSqlite, Name: ":memory:"})
+	assert.NilError(t, err)
+	l := newTestListener(t, store)
+	l.feed = NewChangeFeed(10, 0)
+
+	err = l.handleEvents(closeEvents(), testBlockContext())
+	assert.NilError(t, err)
+	changes, _, _, err := l.feed.From(0)
+	assert.NilError(t, err)
+	assert.Equal(t, len(changes), 1)
+	assert.Equal(t, changes[0].Type, ChangeClose)
+	assert.Equal(t, changes[0].Reason, db.CloseReasonClosed)
+	assert.DeepEqual(t, changes[0].Accounts, []string{"a"})
+}
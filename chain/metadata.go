@@ -0,0 +1,81 @@
+package chain
+
+import (
+	"sync"
+
+	gsrpc "github.com/crustio/go-substrate-rpc-client/v4"
+	"github.com/crustio/go-substrate-rpc-client/v4/types"
+)
+
+// metadataCache holds the metadata of every runtime spec version seen so far, shared by all connections
+type metadataCache struct {
+	lock  sync.RWMutex
+	metas map[uint32]*types.Metadata
+}
+
+var metaCache = &metadataCache{metas: make(map[uint32]*types.Metadata)}
+
+func (m *metadataCache) get(specVersion uint32) (*types.Metadata, bool) {
+	m.lock.RLock()
+	meta, ok := m.metas[specVersion]
+	m.lock.RUnlock()
+	return meta, ok
+}
+
+func (m *metadataCache) set(specVersion uint32, meta *types.Metadata) {
+	m.lock.Lock()
+	m.metas[specVersion] = meta
+	m.lock.Unlock()
+}
+
+// metadataAt returns the metadata of the runtime in effect at the block hash
+func (c *connection) metadataAt(hash *types.Hash) (*types.Metadata, error) {
+	version, err := c.getApi().RPC.State.GetRuntimeVersion(*hash)
+	if err != nil {
+		return nil, err
+	}
+	return c.metadataOf(c.getApi(), uint32(version.SpecVersion), hash)
+}
+
+// metadataOf returns the cached metadata of specVersion, fetching it at hash on a miss
+func (c *connection) metadataOf(api *gsrpc.SubstrateAPI, specVersion uint32, hash *types.Hash) (*types.Metadata, error) {
+	if meta, ok := metaCache.get(specVersion); ok {
+		return meta, nil
+	}
+	meta, err := api.RPC.State.GetMetadata(*hash)
+	if err != nil {
+		return nil, err
+	}
+	c.log.Info("Fetched substrate metadata", "specVersion", specVersion)
+	metaCache.set(specVersion, meta)
+	return meta, nil
+}
+
+// updateLatestMetadata switches the latest metadata used for queries at the chain head when the runtime changes
+func (c *connection) updateLatestMetadata(api *gsrpc.SubstrateAPI) error {
+	hash, err := api.RPC.Chain.GetBlockHashLatest()
+	if err != nil {
+		return err
+	}
+	version, err := api.RPC.State.GetRuntimeVersion(hash)
+	if err != nil {
+		return err
+	}
+	specVersion := uint32(version.SpecVersion)
+	c.metaLock.RLock()
+	current := c.specVersion
+	c.metaLock.RUnlock()
+	if current == specVersion {
+		return nil
+	}
+	meta, err := c.metadataOf(api, specVersion, &hash)
+	if err != nil {
+		return err
+	}
+	c.metaLock.Lock()
+	c.meta = *meta
+	c.specVersion = specVersion
+	c.metaLock.Unlock()
+	c.log.Info("Switched latest metadata", "from", current, "to", specVersion)
+	return nil
+}
@@ -0,0 +1,135 @@
+package chain
+
+import (
+	"fmt"
+	"reflect"
+	"statistic/config"
+	"statistic/db"
+
+	"github.com/crustio/go-substrate-rpc-client/v4/types"
+)
+
+// EventHandler handles a single decoded event, evt is the element type of the matching Events field
+type EventHandler func(ctx *BlockContext, evt interface{}) error
+
+type eventHandler struct {
+	name    string
+	field   string
+	index   []int
+	handler EventHandler
+}
+
+var eventHandlers []*eventHandler
+
+// RegisterEventHandler registers handler for the pallet/event pair under name.
+// Handlers run in registration order, name is used to disable it in config.
+func RegisterEventHandler(name, pallet, event string, handler EventHandler) {
+	field := pallet + "_" + event
+	f, ok := reflect.TypeOf(Events{}).FieldByName(field)
+	if !ok || f.Type.Kind() != reflect.Slice {
+		panic(fmt.Sprintf("register event handler %s: unknown event %s", name, field))
+	}
+	for _, h := range eventHandlers {
+		if h.name == name {
+			panic(fmt.Sprintf("register event handler %s: duplicate name", name))
+		}
+	}
+	eventHandlers = append(eventHandlers, &eventHandler{
+		name:    name,
+		field:   field,
+		index:   f.Index,
+		handler: handler,
+	})
+}
+
+// enabledEventHandlers returns the registered handlers that are not disabled by cfg
+func enabledEventHandlers(cfg config.ChainConfig) []*eventHandler {
+	disabled := make(map[string]bool)
+	for _, name := range cfg.DisabledHandlers {
+		disabled[name] = true
+	}
+	if cfg.UseMarketUpdate {
+		disabled["Swork_WorksReportSuccess"] = true
+	} else {
+		disabled["Market_UpdateReplicasSuccess"] = true
+	}
+	res := make([]*eventHandler, 0, len(eventHandlers))
+	for _, h := range eventHandlers {
+		if !disabled[h.name] {
+			res = append(res, h)
+		}
+	}
+	return res
+}
+
+// dispatchEvents calls every handler with each event of its pallet/event pair
+func dispatchEvents(handlers []*eventHandler, evts *Events, ctx *BlockContext) error {
+	val := reflect.ValueOf(evts).Elem()
+	for _, h := range handlers {
+		list := val.FieldByIndex(h.index)
+		for i := 0; i < list.Len(); i++ {
+			err := h.handler(ctx, list.Index(i).Interface())
+			if err != nil {
+				return fmt.Errorf("event handler %s: %w", h.name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// BlockContext carries the block being processed and collects the changes made by event handlers
+type BlockContext struct {
+	Hash          *types.Hash
+	Number        uint64
+	Timestamp     int64 // Timestamp.set of the block, in second
+	conn          *connection
+	block         *types.SignedBlock
+	ops           map[string]int
+	fileOrders    []db.FileOrder
+	replicaEvents []db.ReplicaEvent
+	renewedCids   []string
+	renewals      []db.FileRenewal
+	// replica accounts of the closed files, read before the replicas are removed
+	closedAccounts map[string][]string
+}
+
+func newBlockContext(conn *connection, hash *types.Hash, number uint64) *BlockContext {
+	return &BlockContext{
+		Hash:       hash,
+		Number:     number,
+		conn:       conn,
+		ops:        make(map[string]int),
+		fileOrders: make([]db.FileOrder, 0, 10),
+	}
+}
+
+// Block fetches the block on first use
+func (b *BlockContext) Block() (*types.SignedBlock, error) {
+	if b.block == nil {
+		block, err := b.conn.GetBlock(b.Hash)
+		if err != nil {
+			return nil, err
+		}
+		b.block = block
+	}
+	return b.block, nil
+}
+
+// SetOp sets the file operation of cid, overriding the previous one
+func (b *BlockContext) SetOp(cid string, op int) {
+	b.ops[cid] = op
+}
+
+// AddOp sets the file operation of cid only if there is none yet
+func (b *BlockContext) AddOp(cid string, op int) {
+	if _, ok := b.ops[cid]; !ok {
+		b.ops[cid] = op
+	}
+}
+
+func (b *BlockContext) AddFileOrder(cid string) {
+	b.fileOrders = append(b.fileOrders, db.FileOrder{
+		Cid:         cid,
+		BlockNumber: b.Number,
+	})
+}
@@ -0,0 +1,57 @@
+package chain
+
+import (
+	"statistic/config"
+	"testing"
+
+	events "github.com/crustio/chainbridge-substrate-events"
+	"gotest.tools/assert"
+)
+
+func TestEnabledEventHandlers(t *testing.T) {
+	handlers := enabledEventHandlers(config.ChainConfig{DisabledHandlers: []string{"Market_RenewFileSuccess"}})
+	names := make(map[string]bool)
+	for _, h := range handlers {
+		names[h.name] = true
+	}
+	assert.Equal(t, names["Market_RenewFileSuccess"], false)
+	assert.Equal(t, names["Market_UpdateReplicasSuccess"], false)
+	assert.Equal(t, names["Swork_WorksReportSuccess"], true)
+	assert.Equal(t, names["Market_FileSuccess"], true)
+}
+
+func TestDispatchEvents(t *testing.T) {
+	evts := &Events{}
+	evts.Market_RenewFileSuccess = []events.EventRenewFileSuccess{{Cid: []byte("a")}, {Cid: []byte("b")}}
+	evts.Market_FileSuccess = []events.EventFileSuccess{{Cid: []byte("a")}}
+	evts.Market_FileClosed = []events.EventFileClosed{{Cid: []byte("c")}}
+
+	ctx := newBlockContext(nil, nil, 100)
+	err := dispatchEvents(enabledEventHandlers(config.ChainConfig{}), evts, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, ctx.ops["a"], New)
+	assert.Equal(t, ctx.ops["b"], UpdateBase)
+	assert.Equal(t, ctx.ops["c"], Delete)
+	assert.Equal(t, len(ctx.fileOrders), 1)
+	assert.Equal(t, ctx.fileOrders[0].BlockNumber, uint64(100))
+	assert.DeepEqual(t, ctx.renewedCids, []string{"a", "b"})
+
+	// renewals are still recorded without updating the file base
+	ctx = newBlockContext(nil, nil, 100)
+	err = dispatchEvents(enabledEventHandlers(config.ChainConfig{DisabledHandlers: []string{"Market_RenewFileSuccess"}}), evts, ctx)
+	assert.NilError(t, err)
+	_, ok := ctx.ops["b"]
+	assert.Equal(t, ok, false)
+	assert.DeepEqual(t, ctx.renewedCids, []string{"a", "b"})
+}
+
+func TestRegisterUnknownEvent(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected panic")
+		}
+	}()
+	RegisterEventHandler("Unknown", "Market", "Unknown", handleFileClosed)
+}
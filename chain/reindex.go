@@ -0,0 +1,59 @@
+package chain
+
+import (
+	"fmt"
+	"statistic/config"
+	"statistic/db"
+
+	"github.com/ChainSafe/log15"
+)
+
+// Reindex runs the listener event handling again over [from, to] against the state of each block.
+// Only the block history (file orders, replica events, renewals and block times) is rebuilt:
+// file_info and replica hold the state at the checkpoint, replaying an older block would roll them back,
+// audit --repair fixes them from chain state instead.
+// The returned stats count the file changes of the range. The IndexBlockNumber checkpoint is left untouched.
+func Reindex(conn *connection, store db.Store, cfg config.ChainConfig, from, to uint64, logger log15.Logger, stop <-chan int) (FileStats, error) {
+	if from > to {
+		return FileStats{}, fmt.Errorf("invalid range %d~%d", from, to)
+	}
+	current, err := store.GetBlockNumber()
+	if err != nil {
+		return FileStats{}, err
+	}
+	if to > current {
+		return FileStats{}, fmt.Errorf("block %d is not processed by the listener yet, current %d", to, current)
+	}
+	l := newReindexer(conn, store, enabledEventHandlers(cfg), logger, stop)
+	for number := from; number <= to; number++ {
+		select {
+		case <-stop:
+			return l.stats, ErrListenerTerminated
+		default:
+		}
+		hash, err := conn.getApi().RPC.Chain.GetBlockHash(number)
+		if err != nil {
+			return l.stats, err
+		}
+		err = l.processEvents(&hash, number)
+		if err != nil {
+			return l.stats, fmt.Errorf("reindex block %d: %w", number, err)
+		}
+		if (number-from)%1000 == 0 {
+			logger.Info("reindex progress", "number", number, "to", to, "created", l.stats.Created, "updated", l.stats.Updated, "deleted", l.stats.Deleted)
+		}
+	}
+	return l.stats, nil
+}
+
+// newReindexer creates a listener that only rebuilds the block history and never moves the checkpoint
+func newReindexer(conn *connection, store db.Store, handlers []*eventHandler, logger log15.Logger, stop <-chan int) *listener {
+	return &listener{
+		conn:        conn,
+		store:       store,
+		log:         logger,
+		stop:        stop,
+		handlers:    handlers,
+		historyOnly: true,
+	}
+}
@@ -0,0 +1,54 @@
+package chain
+
+import (
+	"statistic/config"
+	"statistic/db"
+	"testing"
+
+	"github.com/ChainSafe/log15"
+	events "github.com/crustio/chainbridge-substrate-events"
+	"github.com/crustio/go-substrate-rpc-client/v4/types"
+	"gotest.tools/assert"
+)
+
+func TestReindexKeepsFileState(t *testing.T) {
+	store, err := db.NewStore(config.DbConfig{Type: db.TypeSqlite, Name: ":memory:"})
+	assert.NilError(t, err)
+	// seeds the checkpoint and the open file TestCid
+	newTestListener(t, store)
+	l := newReindexer(nil, store, enabledEventHandlers(config.ChainConfig{}), log15.Root(), nil)
+	// the file created in the reindexed block 10 was closed at block 20, after the range
+	created := "QmCreatedInRange"
+	assert.NilError(t, store.InsertFiles(&db.FileInfo{Cid: created, FileSize: 1}))
+	assert.NilError(t, store.CloseByCid(created, 20, db.CloseReasonClosed))
+	assert.NilError(t, store.UpdateBlockNumber(30))
+
+	evts := closeEvents()
+	evts.Market_FileSuccess = []events.EventFileSuccess{{Cid: types.NewBytes([]byte(created))}}
+	err = l.handleEvents(evts, testBlockContext())
+	assert.NilError(t, err)
+	assert.Equal(t, l.stats, FileStats{Created: 1, Deleted: 1})
+
+	_, err = store.QueryFileByCid(created)
+	assert.Assert(t, err != nil)
+	closed, err := store.ClosedFilesByCid(created)
+	assert.NilError(t, err)
+	assert.Equal(t, len(closed), 1)
+	assert.Equal(t, closed[0].ClosedAt, uint64(20))
+	// the file closed in the range is still open at the checkpoint
+	_, err = store.QueryFileByCid(TestCid)
+	assert.NilError(t, err)
+	closed, err = store.ClosedFilesByCid(TestCid)
+	assert.NilError(t, err)
+	assert.Equal(t, len(closed), 0)
+
+	orders, err := store.FileOrdersBySlot(600)
+	assert.NilError(t, err)
+	assert.Equal(t, orders, int64(1))
+	bt, err := store.BlockTimeAt(10)
+	assert.NilError(t, err)
+	assert.Equal(t, bt.BlockNumber, uint64(10))
+	bn, err := store.GetBlockNumber()
+	assert.NilError(t, err)
+	assert.Equal(t, bn, uint64(30))
+}
@@ -0,0 +1,128 @@
+package chain
+
+import (
+	"statistic/db"
+	"time"
+
+	"github.com/ChainSafe/log15"
+)
+
+const retryPageSize = 200
+
+type errorRetrier struct {
+	conn        *connection
+	store       db.Store
+	interval    time.Duration
+	maxAttempts int
+	log         log15.Logger
+	stop        <-chan int
+	completeCh  <-chan int
+}
+
+func NewErrorRetrier(conn *connection, store db.Store, interval time.Duration, maxAttempts int, logger log15.Logger, stop <-chan int, completeCh <-chan int) *errorRetrier {
+	return &errorRetrier{
+		conn,
+		store,
+		interval,
+		maxAttempts,
+		logger,
+		stop,
+		completeCh,
+	}
+}
+
+func (r *errorRetrier) start() {
+	go func() {
+		select {
+		case <-r.stop:
+			return
+		case <-r.completeCh:
+		}
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.stop:
+				return
+			case <-ticker.C:
+				fixed, dropped, failed, err := RetryErrorFiles(r.conn, r.store, r.maxAttempts)
+				if err != nil {
+					r.log.Error("Retry error files failed", "err", err)
+					continue
+				}
+				if fixed > 0 || dropped > 0 || failed > 0 {
+					r.log.Info("Retry error files done", "fixed", fixed, "dropped", dropped, "failed", failed)
+				}
+			}
+		}
+	}()
+}
+
+// RetryErrorFiles re-queries the files recorded in error_file at the latest block and saves them again.
+// Files that are gone from chain are dropped, files failing maxAttempts times are skipped unless maxAttempts is 0.
+// It returns the number of fixed, dropped and failed files.
+func RetryErrorFiles(conn *connection, store db.Store, maxAttempts int) (int, int, int, error) {
+	hash, err := conn.getApi().RPC.Chain.GetBlockHashLatest()
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	fixed, dropped, failed := 0, 0, 0
+	lastId := 0
+	for {
+		errFiles, err := store.ListErrorFiles(lastId, maxAttempts, retryPageSize)
+		if err != nil {
+			return fixed, dropped, failed, err
+		}
+		if len(errFiles) == 0 {
+			break
+		}
+		lastId = errFiles[len(errFiles)-1].ID
+
+		keys := make([]string, 0, len(errFiles))
+		for _, errFile := range errFiles {
+			keys = append(keys, errFile.Key)
+		}
+		files, err := conn.GetFilesInfoV2ListWithKeys(keys, &hash)
+		if err != nil {
+			for i := range errFiles {
+				if e := store.MarkErrorAttempt(&errFiles[i], err); e != nil {
+					return fixed, dropped, failed, e
+				}
+			}
+			failed += len(errFiles)
+			continue
+		}
+		keyMap := make(map[string]*StorageFile)
+		for _, file := range files {
+			keyMap[file.Key] = file
+		}
+
+		for i := range errFiles {
+			errFile := &errFiles[i]
+			file, ok := keyMap[errFile.Key]
+			if ok {
+				dbFile := file.File.ToFileDto(errFile.Cid, uint32(errFile.BlockNumber))
+				err = store.Transaction(func(tx db.Store) error {
+					return db.WithFileStats(tx, []string{errFile.Cid}, func() error {
+						return tx.SaveFiles(dbFile, false)
+					})
+				})
+				if err != nil {
+					failed++
+					if e := store.MarkErrorAttempt(errFile, err); e != nil {
+						return fixed, dropped, failed, e
+					}
+					continue
+				}
+				fixed++
+			} else {
+				conn.log.Info("Error file no longer on chain, drop it", "cid", errFile.Cid)
+				dropped++
+			}
+			if err = store.DeleteErrorFile(errFile.ID); err != nil {
+				return fixed, dropped, failed, err
+			}
+		}
+	}
+	return fixed, dropped, failed, nil
+}
@@ -96,13 +96,13 @@ func GetCurrentIndex(conn *connection) (uint32, error) {
 
 func GetTopStakeLimit(conn *connection) ([]StakeLimit, error) {
 	startKey := StakeLimitPrefix
-	hash, err := conn.api.RPC.Chain.GetBlockHashLatest()
+	hash, err := conn.getApi().RPC.Chain.GetBlockHashLatest()
 	if err != nil {
 		return nil, err
 	}
 	stakeSlice := make([]StakeLimit, 0, 100)
 	for {
-		keys, err := conn.api.RPC.State.GetKeysPaged(StakeLimitPrefix, 800, startKey, &hash)
+		keys, err := conn.getApi().RPC.State.GetKeysPaged(StakeLimitPrefix, 800, startKey, &hash)
 		if err != nil {
 			return nil, err
 		}
@@ -163,13 +163,13 @@ func GetAuthoringPayout(conn *connection) (map[uint32]float64, error) {
 
 func getAuthoringPayout(conn *connection, prefix string) (map[uint32]float64, error) {
 	startKey := prefix
-	hash, err := conn.api.RPC.Chain.GetBlockHashLatest()
+	hash, err := conn.getApi().RPC.Chain.GetBlockHashLatest()
 	if err != nil {
 		return nil, err
 	}
 	resMap := make(map[uint32]float64)
 	for {
-		keys, err := conn.api.RPC.State.GetKeysPaged(prefix, 1000, startKey, &hash)
+		keys, err := conn.getApi().RPC.State.GetKeysPaged(prefix, 1000, startKey, &hash)
 		if err != nil {
 			return nil, err
 		}
@@ -216,11 +216,11 @@ func getAuthoringPayout(conn *connection, prefix string) (map[uint32]float64, er
 
 func getStakes(conn *connection, prefix string) ([]Stake, error) {
 	startKey := prefix
-	hash, err := conn.api.RPC.Chain.GetBlockHashLatest()
+	hash, err := conn.getApi().RPC.Chain.GetBlockHashLatest()
 	if err != nil {
 		return nil, err
 	}
-	keys, err := conn.api.RPC.State.GetKeysPaged(prefix, 1000, startKey, &hash)
+	keys, err := conn.getApi().RPC.State.GetKeysPaged(prefix, 1000, startKey, &hash)
 	if err != nil {
 		return nil, err
 	}
@@ -8,7 +8,7 @@ import (
 
 func ExampleStakeByIndex() {
 	stop := make(chan int)
-	conn := NewConnection(TestUrl, log.Root(), stop)
+	conn := NewConnection([]string{TestUrl}, log.Root(), stop)
 	err := conn.Connect()
 	if err != nil {
 		panic(err)
@@ -19,7 +19,7 @@ func ExampleStakeByIndex() {
 
 func ExampleTotalStake() {
 	stop := make(chan int)
-	conn := NewConnection(TestUrl, log.Root(), stop)
+	conn := NewConnection([]string{TestUrl}, log.Root(), stop)
 	err := conn.Connect()
 	if err != nil {
 		panic(err)
@@ -30,7 +30,7 @@ func ExampleTotalStake() {
 
 func ExampleStakeLimit() {
 	stop := make(chan int)
-	conn := NewConnection(TestUrl, log.Root(), stop)
+	conn := NewConnection([]string{TestUrl}, log.Root(), stop)
 	err := conn.Connect()
 	if err != nil {
 		panic(err)
@@ -41,7 +41,7 @@ func ExampleStakeLimit() {
 
 func TestPayout(t *testing.T) {
 	stop := make(chan int)
-	conn := NewConnection(TestUrl, log.Root(), stop)
+	conn := NewConnection([]string{TestUrl}, log.Root(), stop)
 	err := conn.Connect()
 	if err != nil {
 		panic(err)
@@ -62,7 +62,7 @@ func TestPayout(t *testing.T) {
 
 func TestPayoutByIndex(t *testing.T) {
 	stop := make(chan int)
-	conn := NewConnection(TestUrl, log.Root(), stop)
+	conn := NewConnection([]string{TestUrl}, log.Root(), stop)
 	err := conn.Connect()
 	if err != nil {
 		panic(err)
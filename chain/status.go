@@ -0,0 +1,89 @@
+package chain
+
+import "statistic/config"
+
+// SegmentStatus is the progress of one initial fetch segment
+type SegmentStatus struct {
+	End     uint64 `json:"end"`
+	Current uint64 `json:"current"` // last block saved from check_point
+	Done    bool   `json:"done"`
+}
+
+// Status reports the ingest progress, the fields that could not be read carry the error instead
+type Status struct {
+	Fetching  bool            `json:"fetching"` // the initial fetch is not complete
+	Bootstrap string          `json:"bootstrap"`
+	Segments  []SegmentStatus `json:"segments,omitempty"`
+	Loaded    uint64          `json:"loaded,omitempty"` // files loaded by the snapshot bootstrap
+	Current   uint64          `json:"current"`          // last block committed by the listener
+	Finalized uint64          `json:"finalized"`
+	Lag       uint64          `json:"lag"`
+	DbErr     string          `json:"db_error,omitempty"`
+	RpcErr    string          `json:"rpc_error,omitempty"`
+}
+
+// Fetching tells whether the initial fetch is still running
+func (c *Chain) Fetching() bool {
+	select {
+	case <-c.fetcher.getCompleteCh():
+		return false
+	default:
+		return true
+	}
+}
+
+// Status reads the checkpoints from the store and the finalized head from the chain
+func (c *Chain) Status() *Status {
+	st := &Status{Fetching: c.Fetching(), Bootstrap: config.BootstrapEvents}
+	if err := c.fetcher.status(st); err != nil {
+		st.DbErr = err.Error()
+	}
+	current, err := c.fetcher.store.GetBlockNumber()
+	if err != nil {
+		st.DbErr = err.Error()
+	}
+	st.Current = current
+	finalized, err := c.finalizedHead()
+	if err != nil {
+		st.RpcErr = err.Error()
+	}
+	st.Finalized = finalized
+	if finalized > current && current > 0 {
+		st.Lag = finalized - current
+	}
+	return st
+}
+
+func (c *Chain) finalizedHead() (uint64, error) {
+	api := c.conn.getApi()
+	hash, err := api.RPC.Chain.GetFinalizedHead()
+	if err != nil {
+		return 0, err
+	}
+	header, err := api.RPC.Chain.GetHeader(hash)
+	if err != nil {
+		return 0, err
+	}
+	return uint64(header.Number), nil
+}
+
+func (f *fetcher) status(st *Status) error {
+	if f.snapshot {
+		st.Bootstrap = config.BootstrapSnapshot
+		if !st.Fetching {
+			return nil
+		}
+		_, loaded, err := f.store.GetStorageKey(f.initBlock)
+		st.Loaded = loaded
+		return err
+	}
+	cps, err := f.store.SegmentCheckPoints()
+	if err != nil {
+		return err
+	}
+	for _, segf := range f.segfs {
+		current := cps[segf.end]
+		st.Segments = append(st.Segments, SegmentStatus{segf.end, current, current >= segf.end})
+	}
+	return nil
+}
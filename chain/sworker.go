@@ -3,6 +3,7 @@ package chain
 import (
 	log "github.com/ChainSafe/log15"
 	"github.com/crustio/go-substrate-rpc-client/v4/types"
+	"statistic/config"
 	"statistic/db"
 )
 
@@ -12,14 +13,14 @@ const GroupPrefix = "0x2e3b7ab5757e6bbf28d3df3b5e01d6b92f583424865f2346c0f5c066f
 
 const PubKeysPrefix = "0x2e3b7ab5757e6bbf28d3df3b5e01d6b903a855d33d7969c08d438e66ce6f999e"
 
-func GetGroupInfo(conn *connection) error {
+func GetGroupInfo(conn *connection, store db.Store, snapshotId int) error {
 	startKey := GroupPrefix
-	hash, err := conn.api.RPC.Chain.GetBlockHashLatest()
+	hash, err := conn.getApi().RPC.Chain.GetBlockHashLatest()
 	if err != nil {
 		return err
 	}
 	for {
-		keys, err := conn.api.RPC.State.GetKeysPaged(GroupPrefix, 500, startKey, &hash)
+		keys, err := conn.getApi().RPC.State.GetKeysPaged(GroupPrefix, 500, startKey, &hash)
 		if err != nil {
 			return err
 		}
@@ -74,13 +75,17 @@ func GetGroupInfo(conn *connection) error {
 		if len(subQuery) > 0 {
 			queryMember(subQuery, conn, &hash, data)
 		}
-		saveGroups(gs, data)
+		err = saveGroups(store, snapshotId, gs, data)
+		if err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
-func saveGroups(groups []*group, data map[string]string) error {
+func saveGroups(store db.Store, snapshotId int, groups []*group, data map[string]string) error {
 	dbg := make([]*db.SworkerGroup, 0, len(groups))
+	members := make([]*db.GroupMember, 0)
 	var err error
 	for _, group := range groups {
 		var active db.GroupInfo
@@ -89,10 +94,11 @@ func saveGroups(groups []*group, data map[string]string) error {
 			for _, member := range group.Members {
 				if v, ok := data[types.HexEncodeToString(member[:])]; ok {
 					anchors = append(anchors, v)
+					members = append(members, &db.GroupMember{GId: group.GId, Member: encodeAccount(member[:]), Anchor: v})
 				}
 			}
 			if len(anchors) > 0 {
-				active, err = db.GetGroupInfo(anchors)
+				active, err = store.GetGroupInfo(snapshotId, anchors)
 				if err != nil {
 					return err
 				}
@@ -100,7 +106,11 @@ func saveGroups(groups []*group, data map[string]string) error {
 		}
 		dbg = append(dbg, group.ToDto(active))
 	}
-	return db.SaveGroups(dbg)
+	err = store.SaveGroups(snapshotId, dbg)
+	if err != nil {
+		return err
+	}
+	return store.SaveGroupMembers(snapshotId, members)
 }
 
 func queryMember(subQuery []types.StorageKey, conn *connection, hash *types.Hash, data map[string]string) error {
@@ -123,22 +133,22 @@ func queryMember(subQuery []types.StorageKey, conn *connection, hash *types.Hash
 	return nil
 }
 
-func GetAllSworkReports(conn *connection) (int, int, error) {
+func GetAllSworkReports(conn *connection, store db.Store, snapshotId int) (int, int, error) {
 	startKey := SworkReportsPrefix
-	hash, err := conn.api.RPC.Chain.GetBlockHashLatest()
+	hash, err := conn.getApi().RPC.Chain.GetBlockHashLatest()
 	if err != nil {
 		return 0, 0, err
 	}
-	head, err := conn.api.RPC.Chain.GetHeaderLatest()
+	head, err := conn.getApi().RPC.Chain.GetHeaderLatest()
 	if err != nil {
 		return 0, 0, err
 	}
-	lastSlot := uint64(head.Number) / SlotSize * SlotSize
-	activeSlot := lastSlot - 6*SlotSize
+	lastSlot := uint64(head.Number) / config.SlotBlocks * config.SlotBlocks
+	activeSlot := lastSlot - 6*config.SlotBlocks
 	allCount := 0
 	activeCount := 0
 	for {
-		keys, err := conn.api.RPC.State.GetKeysPaged(SworkReportsPrefix, 500, startKey, &hash)
+		keys, err := conn.getApi().RPC.State.GetKeysPaged(SworkReportsPrefix, 500, startKey, &hash)
 		if err != nil {
 			return 0, 0, err
 		}
@@ -180,7 +190,7 @@ func GetAllSworkReports(conn *connection) (int, int, error) {
 			}
 		}
 		activeCount += len(res)
-		err = db.SaveWorkReports(res)
+		err = store.SaveWorkReports(snapshotId, res)
 		if err != nil {
 			return 0, 0, err
 		}
@@ -190,14 +200,14 @@ func GetAllSworkReports(conn *connection) (int, int, error) {
 	return allCount, activeCount, nil
 }
 
-func GetPubKeys(conn *connection) error {
+func GetPubKeys(conn *connection, store db.Store, snapshotId int) error {
 	startKey := PubKeysPrefix
-	hash, err := conn.api.RPC.Chain.GetBlockHashLatest()
+	hash, err := conn.getApi().RPC.Chain.GetBlockHashLatest()
 	if err != nil {
 		return err
 	}
 	for {
-		keys, err := conn.api.RPC.State.GetKeysPaged(PubKeysPrefix, 800, startKey, &hash)
+		keys, err := conn.getApi().RPC.State.GetKeysPaged(PubKeysPrefix, 800, startKey, &hash)
 		if err != nil {
 			return err
 		}
@@ -232,7 +242,7 @@ func GetPubKeys(conn *connection) error {
 			}
 		}
 
-		err = db.SavePubKeys(res)
+		err = store.SavePubKeys(snapshotId, res)
 		if err != nil {
 			return err
 		}
@@ -244,11 +254,11 @@ func GetPubKeys(conn *connection) error {
 
 //
 //func GetVersionData(conn *connection) (map[string]int, error) {
-//	anchors, err := db.ActiveAnchors()
+//	anchors, err := store.ActiveAnchors()
 //	if err != nil {
 //		return nil, err
 //	}
-//	hash, err := conn.api.RPC.Chain.GetBlockHashLatest()
+//	hash, err := conn.getApi().RPC.Chain.GetBlockHashLatest()
 //	queryKeys := make([]types.StorageKey, 0, 1000)
 //	resMap := make(map[string]int)
 //	for _, anchor := range anchors {
@@ -34,7 +34,7 @@ func getConfig() config.DbConfig {
 
 func TestSworkKey(t *testing.T) {
 	stop := make(chan int)
-	conn := NewConnection(TestUrl, log.Root(), stop)
+	conn := NewConnection([]string{TestUrl}, log.Root(), stop)
 	err := conn.Connect()
 	if err != nil {
 		panic(err)
@@ -64,7 +64,7 @@ func TestSworkKey(t *testing.T) {
 
 func TestGroups(t *testing.T) {
 	stop := make(chan int)
-	conn := NewConnection(TestUrl, log.Root(), stop)
+	conn := NewConnection([]string{TestUrl}, log.Root(), stop)
 	conn.Connect()
 	//api := conn.api
 	_, ab, _ := SS58Decode(GroupId)
@@ -89,7 +89,7 @@ func TestGroups(t *testing.T) {
 
 func TestIdentityID(t *testing.T) {
 	stop := make(chan int)
-	conn := NewConnection(TestUrl, log.Root(), stop)
+	conn := NewConnection([]string{TestUrl}, log.Root(), stop)
 	conn.Connect()
 	_, ab, _ := SS58Decode(MemberId)
 	println(types.HexEncodeToString(ab))
@@ -100,10 +100,17 @@ func TestIdentityID(t *testing.T) {
 
 func TestGetGroups(t *testing.T) {
 	stop := make(chan int)
-	conn := NewConnection(TestUrl, log.Root(), stop)
+	conn := NewConnection([]string{TestUrl}, log.Root(), stop)
 	conn.Connect()
-	db.InitMysql(getConfig())
-	err := GetGroupInfo(conn)
+	store, err := db.NewStore(getConfig())
+	if err != nil {
+		panic(err)
+	}
+	snapshot, err := store.CreateSnapshot(conn.GetLatestHeight())
+	if err != nil {
+		panic(err)
+	}
+	err = GetGroupInfo(conn, store, snapshot.ID)
 	if err != nil {
 		panic(err)
 	}
@@ -111,7 +118,7 @@ func TestGetGroups(t *testing.T) {
 
 func TestIdentity(t *testing.T) {
 	stop := make(chan int)
-	conn := NewConnection(TestUrl, log.Root(), stop)
+	conn := NewConnection([]string{TestUrl}, log.Root(), stop)
 	conn.Connect()
 	//api := conn.api
 	_, ab, _ := SS58Decode(AccountId)
@@ -134,7 +141,7 @@ func TestIdentity(t *testing.T) {
 
 func TestVersion(t *testing.T) {
 	stop := make(chan int)
-	conn := NewConnection(TestUrl, log.Root(), stop)
+	conn := NewConnection([]string{TestUrl}, log.Root(), stop)
 	conn.Connect()
 	ab := types.MustHexDecodeString(ActiveAnchor)
 	anchorByte, _ := types.EncodeToBytes(ab)
@@ -158,10 +165,17 @@ func TestVersion(t *testing.T) {
 
 func TestGetVersion(t *testing.T) {
 	stop := make(chan int)
-	conn := NewConnection(TestUrl, log.Root(), stop)
+	conn := NewConnection([]string{TestUrl}, log.Root(), stop)
 	conn.Connect()
-	db.InitMysql(getConfig())
-	err := GetPubKeys(conn)
+	store, err := db.NewStore(getConfig())
+	if err != nil {
+		panic(err)
+	}
+	snapshot, err := store.CreateSnapshot(conn.GetLatestHeight())
+	if err != nil {
+		panic(err)
+	}
+	err = GetPubKeys(conn, store, snapshot.ID)
 	if err != nil {
 		panic(err)
 	}
@@ -208,6 +208,19 @@ func (w *group) ToDto(active db.GroupInfo) *db.SworkerGroup {
 	}
 }
 
+// balanceDelta returns new - old of two decimal balances, unparsable values count as 0
+func balanceDelta(before, after string) string {
+	o, ok := new(big.Int).SetString(before, 10)
+	if !ok {
+		o = big.NewInt(0)
+	}
+	n, ok := new(big.Int).SetString(after, 10)
+	if !ok {
+		n = big.NewInt(0)
+	}
+	return n.Sub(n, o).String()
+}
+
 func getInt64(val *big.Int) int64 {
 	if val == nil {
 		return 0
@@ -22,3 +22,9 @@ func TestDecode(t *testing.T) {
 	}
 	println(utiles.BytesToHex(bs))
 }
+
+func TestBalanceDelta(t *testing.T) {
+	assert.Equal(t, balanceDelta("100000000000000000000", "100000000000000000250"), "250")
+	assert.Equal(t, balanceDelta("300", "100"), "-200")
+	assert.Equal(t, balanceDelta("", "42"), "42")
+}
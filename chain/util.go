@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"regexp"
 	"statistic/config"
+	"statistic/db"
 
 	"github.com/crustio/go-substrate-rpc-client/v4/types"
 	"github.com/crustio/go-substrate-rpc-client/v4/xxhash"
@@ -14,8 +15,6 @@ import (
 	"golang.org/x/crypto/blake2b"
 )
 
-const SlotSize = 600
-
 func convertAccount(hex string) string {
 	bytes := utiles.HexToBytes(hex)
 	return SS58Encode(bytes, config.NetworkID)
@@ -122,6 +121,42 @@ func decodeCidsFromSworkReport(block *types.SignedBlock, index int) ([]string, e
 	return res, nil
 }
 
+// decodeReplicaEventsFromSworkReport returns an add or delete event for every file of the report_works extrinsic
+func decodeReplicaEventsFromSworkReport(block *types.SignedBlock, index int, reporter string, number uint64) ([]db.ReplicaEvent, error) {
+	if len(block.Block.Extrinsics) <= index {
+		return nil, errors.New("extrinsic out index")
+	}
+	ext := block.Block.Extrinsics[index]
+	val, err := decodeReportWork(ext.Method.Args)
+	if err != nil {
+		return nil, err
+	}
+
+	anchor := types.HexEncodeToString(val.CurPk)
+	res := make([]db.ReplicaEvent, 0, len(val.Add)+len(val.Del))
+	for _, file := range val.Add {
+		res = append(res, db.ReplicaEvent{
+			Cid:         string(file.Cid),
+			Anchor:      anchor,
+			Reporter:    reporter,
+			Slot:        uint64(val.Slot),
+			BlockNumber: number,
+			IsAdd:       true,
+		})
+	}
+	for _, file := range val.Del {
+		res = append(res, db.ReplicaEvent{
+			Cid:         string(file.Cid),
+			Anchor:      anchor,
+			Reporter:    reporter,
+			Slot:        uint64(val.Slot),
+			BlockNumber: number,
+			IsAdd:       false,
+		})
+	}
+	return res, nil
+}
+
 func decodeReportWork(args types.Args) (*reportWork, error) {
 	val := &reportWork{}
 	err := types.DecodeFromBytes(args, val)
@@ -67,6 +67,17 @@ func TestPrefix(t *testing.T) {
 	assert.Equal(t, hexKey[:66], prefix)
 }
 
+func TestDecodeTimestampNow(t *testing.T) {
+	data, err := types.EncodeToBytes(types.NewU64(1700000000123))
+	assert.NilError(t, err)
+	ts, err := decodeTimestampNow(data)
+	assert.NilError(t, err)
+	assert.Equal(t, ts, int64(1700000000))
+	_, err = decodeTimestampNow(nil)
+	assert.ErrorContains(t, err, "no timestamp")
+	assert.Equal(t, timestampNowKey, "0xf0c365c3cf59d671eb72da0e7a4113c49f1f0515f462cdcf84e0f1d6045dfcbb")
+}
+
 func Example_DecodeReportWork() {
 
 	api, _ := gsrpc.NewSubstrateAPI(TestUrl)
@@ -103,3 +114,35 @@ func TestDecodeUpdateSpower(t *testing.T) {
 		println(cid)
 	}
 }
+
+func TestDecodeReplicaEvents(t *testing.T) {
+	report := reportWork{
+		CurPk:    SworkerPubKey{0x01, 0x02},
+		Slot:     types.NewU64(4888800),
+		SlotHash: []byte{},
+		Add:      []CidExt{{Cid: []byte("abc")}, {Cid: []byte("def")}},
+		Del:      []CidExt{{Cid: []byte("ghi")}},
+	}
+	args, err := types.EncodeToBytes(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block := &types.SignedBlock{}
+	block.Block.Extrinsics = []types.Extrinsic{{}, {Method: types.Call{Args: args}}}
+
+	evts, err := decodeReplicaEventsFromSworkReport(block, 1, TestAcc, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(evts), 3)
+	assert.Equal(t, evts[0].Cid, "abc")
+	assert.Equal(t, evts[0].Anchor, "0x0102")
+	assert.Equal(t, evts[0].Slot, uint64(4888800))
+	assert.Equal(t, evts[0].IsAdd, true)
+	assert.Equal(t, evts[2].Cid, "ghi")
+	assert.Equal(t, evts[2].IsAdd, false)
+	assert.Equal(t, evts[2].Reporter, TestAcc)
+
+	_, err = decodeReplicaEventsFromSworkReport(block, 2, TestAcc, 100)
+	assert.Error(t, err, "extrinsic out index")
+}
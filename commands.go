@@ -0,0 +1,236 @@
+package main
+
+import (
+	"fmt"
+	"statistic/chain"
+	"statistic/config"
+	"statistic/db"
+	"time"
+
+	log "github.com/ChainSafe/log15"
+	"github.com/urfave/cli/v2"
+)
+
+var commands = []*cli.Command{
+	errorsCommand,
+	reindexCommand,
+	migrateCommand,
+	auditCommand,
+}
+
+var errorsCommand = &cli.Command{
+	Name:  "errors",
+	Usage: "Manage files that failed to be saved",
+	Subcommands: []*cli.Command{
+		{
+			Name:   "list",
+			Usage:  "List error files",
+			Flags:  []cli.Flag{config.LimitFlag},
+			Action: listErrors,
+		},
+		{
+			Name:   "retry",
+			Usage:  "Re-query error files from chain and save them again",
+			Flags:  []cli.Flag{config.AttemptsFlag},
+			Action: retryErrors,
+		},
+		{
+			Name:   "purge",
+			Usage:  "Delete error files",
+			Flags:  []cli.Flag{config.AttemptsFlag},
+			Action: purgeErrors,
+		},
+	},
+}
+
+var reindexCommand = &cli.Command{
+	Name:   "reindex",
+	Usage:  "Rebuild the block history of a range, the file state and the listener checkpoint are left untouched",
+	Flags:  []cli.Flag{config.FromFlag, config.ToFlag},
+	Action: reindex,
+}
+
+var migrateCommand = &cli.Command{
+	Name:  "migrate",
+	Usage: "Manage the database schema version",
+	Subcommands: []*cli.Command{
+		{
+			Name:   "up",
+			Usage:  "Apply pending migrations",
+			Flags:  []cli.Flag{config.TargetFlag},
+			Action: migrateUp,
+		},
+		{
+			Name:   "down",
+			Usage:  "Revert applied migrations",
+			Flags:  []cli.Flag{config.StepsFlag},
+			Action: migrateDown,
+		},
+		{
+			Name:   "status",
+			Usage:  "List migrations and when they were applied",
+			Action: migrateStatus,
+		},
+	},
+}
+
+var auditCommand = &cli.Command{
+	Name:   "audit",
+	Usage:  "Compare file_info and replica with Market.FilesV2 on chain",
+	Flags:  []cli.Flag{config.BlockFlag, config.RepairFlag},
+	Action: audit,
+}
+
+// setup loads the config and opens the store for one-off commands
+func setup(ctx *cli.Context) (*config.Config, db.Store, error) {
+	err := startLogger(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	cfg, err := config.GetConfig(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	store, err := db.NewStore(cfg.Db)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cfg, store, nil
+}
+
+func listErrors(ctx *cli.Context) error {
+	_, store, err := setup(ctx)
+	if err != nil {
+		return err
+	}
+	files, err := store.ListErrorFiles(0, 0, ctx.Int(config.LimitFlag.Name))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%-8s %-64s %-10s %-8s %s\n", "ID", "CID", "BLOCK", "ATTEMPTS", "LAST ERROR")
+	for _, f := range files {
+		fmt.Printf("%-8d %-64s %-10d %-8d %s\n", f.ID, f.Cid, f.BlockNumber, f.Attempts, f.LastError)
+	}
+	return nil
+}
+
+func retryErrors(ctx *cli.Context) error {
+	cfg, store, err := setup(ctx)
+	if err != nil {
+		return err
+	}
+	stop := make(chan int)
+	defer close(stop)
+	conn, err := chain.Connect(cfg.Chain, log.Root(), stop)
+	if err != nil {
+		return err
+	}
+	fixed, dropped, failed, err := chain.RetryErrorFiles(conn, store, ctx.Int(config.AttemptsFlag.Name))
+	fmt.Printf("fixed: %d, dropped: %d, failed: %d\n", fixed, dropped, failed)
+	return err
+}
+
+func purgeErrors(ctx *cli.Context) error {
+	_, store, err := setup(ctx)
+	if err != nil {
+		return err
+	}
+	cnt, err := store.PurgeErrorFiles(ctx.Int(config.AttemptsFlag.Name))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("purged: %d\n", cnt)
+	return nil
+}
+
+func reindex(ctx *cli.Context) error {
+	cfg, store, err := setup(ctx)
+	if err != nil {
+		return err
+	}
+	stop := make(chan int)
+	defer close(stop)
+	conn, err := chain.Connect(cfg.Chain, log.Root(), stop)
+	if err != nil {
+		return err
+	}
+	from, to := ctx.Uint64(config.FromFlag.Name), ctx.Uint64(config.ToFlag.Name)
+	stats, err := chain.Reindex(conn, store, cfg.Chain, from, to, log.Root(), stop)
+	fmt.Printf("created: %d, updated: %d, deleted: %d\n", stats.Created, stats.Updated, stats.Deleted)
+	return err
+}
+
+// openStore opens the store without applying migrations
+func openStore(ctx *cli.Context) (db.Store, error) {
+	err := startLogger(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := config.GetConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.OpenStore(cfg.Db)
+}
+
+func migrateUp(ctx *cli.Context) error {
+	store, err := openStore(ctx)
+	if err != nil {
+		return err
+	}
+	return store.MigrateUp(ctx.Int(config.TargetFlag.Name))
+}
+
+func migrateDown(ctx *cli.Context) error {
+	store, err := openStore(ctx)
+	if err != nil {
+		return err
+	}
+	return store.MigrateDown(ctx.Int(config.StepsFlag.Name))
+}
+
+func migrateStatus(ctx *cli.Context) error {
+	store, err := openStore(ctx)
+	if err != nil {
+		return err
+	}
+	states, err := store.MigrationStatus()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%-8s %-40s %s\n", "VERSION", "NAME", "APPLIED AT")
+	for _, st := range states {
+		applied := "pending"
+		if st.AppliedAt > 0 {
+			applied = time.Unix(st.AppliedAt, 0).Format(time.RFC3339)
+		}
+		fmt.Printf("%-8d %-40s %s\n", st.Version, st.Name, applied)
+	}
+	return nil
+}
+
+func audit(ctx *cli.Context) error {
+	cfg, store, err := setup(ctx)
+	if err != nil {
+		return err
+	}
+	stop := make(chan int)
+	defer close(stop)
+	conn, err := chain.Connect(cfg.Chain, log.Root(), stop)
+	if err != nil {
+		return err
+	}
+	report, err := chain.Audit(conn, store, ctx.Uint64(config.BlockFlag.Name), ctx.Bool(config.RepairFlag.Name), log.Root(), stop)
+	for _, cid := range report.Missing {
+		fmt.Printf("missing   %s\n", cid)
+	}
+	for _, cid := range report.Extra {
+		fmt.Printf("extra     %s\n", cid)
+	}
+	for _, cid := range report.Divergent {
+		fmt.Printf("divergent %s\n", cid)
+	}
+	fmt.Printf("block: %d, checked: %d, missing: %d, extra: %d, divergent: %d, repaired: %d\n",
+		report.Block, report.Checked, len(report.Missing), len(report.Extra), len(report.Divergent), report.Repaired)
+	return err
+}
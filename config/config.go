@@ -9,20 +9,44 @@ import (
 const DefaultConfigPath = "./config.ini"
 const NetworkID = 66
 
+// Chain time in blocks, a block is produced every 6 seconds
+const (
+	SlotBlocks = 600
+	DayBlocks  = 14400
+)
+
+// Initial sync modes of ChainConfig.Bootstrap
+const (
+	BootstrapEvents   = "events"
+	BootstrapSnapshot = "snapshot"
+)
+
 type Config struct {
-	Chain  ChainConfig
-	Db     DbConfig
-	Metric MetricConfig
+	Chain     ChainConfig
+	Db        DbConfig
+	Metric    MetricConfig
+	Retention RetentionConfig
 }
 
 type ChainConfig struct {
-	Url             string
-	StartBlock      uint64
-	Size            uint64
-	Confirm         int
-	UseMarketUpdate bool
-	UpdateSize      uint64
-	ZeroNumber      uint64
+	Url              string
+	Urls             []string
+	StartBlock       uint64
+	Size             uint64
+	Confirm          int
+	UseMarketUpdate  bool
+	UpdateSize       uint64
+	ZeroNumber       uint64
+	DisabledHandlers []string
+	Bootstrap        string
+	// in second
+	ErrorRetryInterval int
+	ErrorMaxAttempts   int
+	// in second, 0 disables the scheduled audit
+	AuditInterval int
+	AuditRepair   bool
+	// number of file changes buffered for the change stream
+	StreamBuffer int
 }
 
 type MetricConfig struct {
@@ -35,6 +59,12 @@ type MetricConfig struct {
 	Env             string
 	Codes           []string
 	Versions        []string
+	// in second
+	SnapshotRetention int
+	// number of storage providers exported by the top provider gauges
+	TopProviders int
+	// in second, the top providers aggregate every replica so they are refreshed less often
+	TopProvidersInterval int
 }
 
 type DbConfig struct {
@@ -72,13 +102,28 @@ func loadConfig(filePath string, config *Config) error {
 	if err != nil {
 		log.Error("load section error", "section", "chain", "error", err)
 	}
+	if len(chain.Urls) == 0 && chain.Url != "" {
+		chain.Urls = []string{chain.Url}
+	}
 	if chain.Size == 0 {
 		chain.Size = 500000
 	}
 
+	if chain.Bootstrap == "" {
+		chain.Bootstrap = BootstrapEvents
+	}
 	if chain.UpdateSize == 0 {
 		chain.UpdateSize = 100
 	}
+	if chain.ErrorRetryInterval == 0 {
+		chain.ErrorRetryInterval = 600
+	}
+	if chain.ErrorMaxAttempts == 0 {
+		chain.ErrorMaxAttempts = 10
+	}
+	if chain.StreamBuffer == 0 {
+		chain.StreamBuffer = 10000
+	}
 	db := DbConfig{}
 	cfg.Section("db").MapTo(&db)
 	if err != nil {
@@ -101,10 +146,35 @@ func loadConfig(filePath string, config *Config) error {
 	if metric.StakeInterval == 0 {
 		metric.StakeInterval = 3600 * 6
 	}
+	if metric.TopProviders == 0 {
+		metric.TopProviders = 50
+	}
+	if metric.TopProvidersInterval == 0 {
+		metric.TopProvidersInterval = metric.StakeInterval
+	}
+	if metric.SnapshotRetention == 0 {
+		metric.SnapshotRetention = 3600 * 24 * 7
+	}
+
+	retention := RetentionConfig{}
+	err = cfg.Section("retention").MapTo(&retention)
+	if err != nil {
+		log.Error("load section error", "section", "retention", "error", err)
+	}
+	if retention.Interval == 0 {
+		retention.Interval = 3600
+	}
+	if retention.BatchSize == 0 {
+		retention.BatchSize = 1000
+	}
+	if _, err = retention.Policies(); err != nil {
+		return err
+	}
 
 	config.Chain = chain
 	config.Db = db
 	config.Metric = metric
+	config.Retention = retention
 	if len(metric.Codes) != len(metric.Versions) {
 		panic("metric codes versions length error")
 	}
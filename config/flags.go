@@ -16,4 +16,48 @@ var (
 		Usage: "Supports levels crit (silent) to trce (trace)",
 		Value: log.LvlInfo.String(),
 	}
+
+	LimitFlag = &cli.IntFlag{
+		Name:  "limit",
+		Usage: "Maximum number of rows to list",
+		Value: 100,
+	}
+
+	FromFlag = &cli.Uint64Flag{
+		Name:     "from",
+		Usage:    "First block number of the range",
+		Required: true,
+	}
+
+	ToFlag = &cli.Uint64Flag{
+		Name:     "to",
+		Usage:    "Last block number of the range",
+		Required: true,
+	}
+
+	TargetFlag = &cli.IntFlag{
+		Name:  "target",
+		Usage: "Schema version to migrate up to, 0 for the latest",
+	}
+
+	StepsFlag = &cli.IntFlag{
+		Name:  "steps",
+		Usage: "Number of migrations to revert",
+		Value: 1,
+	}
+
+	BlockFlag = &cli.Uint64Flag{
+		Name:  "block",
+		Usage: "Block number to audit at, it must be the listener checkpoint, 0 to follow the checkpoint",
+	}
+
+	RepairFlag = &cli.BoolFlag{
+		Name:  "repair",
+		Usage: "Fix the database from chain state",
+	}
+
+	AttemptsFlag = &cli.IntFlag{
+		Name:  "attempts",
+		Usage: "Only error files that failed fewer (retry) or at least (purge) this many times, 0 for all",
+	}
 )
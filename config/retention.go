@@ -0,0 +1,70 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// RetentionConfig holds a policy for each history table, empty keeps the rows forever.
+// A policy is "<N>days" or "<N>slots", prefixed with "rollup:" to keep per slot counts of the pruned rows.
+type RetentionConfig struct {
+	// in second
+	Interval     int
+	BatchSize    int
+	FileOrder    string
+	ReplicaEvent string
+	FileRenewal  string
+	ClosedFile   string
+}
+
+// RetentionPolicy prunes the rows older than Blocks behind the listener
+type RetentionPolicy struct {
+	Blocks uint64
+	Rollup bool
+}
+
+// Policies parses the policies by table name
+func (c RetentionConfig) Policies() (map[string]RetentionPolicy, error) {
+	res := make(map[string]RetentionPolicy)
+	for table, policy := range map[string]string{
+		"file_order":    c.FileOrder,
+		"replica_event": c.ReplicaEvent,
+		"file_renewal":  c.FileRenewal,
+		"closed_file":   c.ClosedFile,
+	} {
+		if policy == "" {
+			continue
+		}
+		p, err := parseRetentionPolicy(policy)
+		if err != nil {
+			return nil, fmt.Errorf("retention of %s: %w", table, err)
+		}
+		res[table] = p
+	}
+	return res, nil
+}
+
+func parseRetentionPolicy(policy string) (RetentionPolicy, error) {
+	var res RetentionPolicy
+	if strings.HasPrefix(policy, "rollup:") {
+		res.Rollup = true
+		policy = strings.TrimPrefix(policy, "rollup:")
+	}
+	unit := uint64(0)
+	if strings.HasSuffix(policy, "days") {
+		unit = DayBlocks
+		policy = strings.TrimSuffix(policy, "days")
+	} else if strings.HasSuffix(policy, "slots") {
+		unit = SlotBlocks
+		policy = strings.TrimSuffix(policy, "slots")
+	} else {
+		return res, fmt.Errorf("invalid policy %s, want <N>days or <N>slots", policy)
+	}
+	n, err := strconv.ParseUint(policy, 10, 64)
+	if err != nil || n == 0 {
+		return res, fmt.Errorf("invalid policy %s, want a positive number", policy)
+	}
+	res.Blocks = n * unit
+	return res, nil
+}
@@ -0,0 +1,42 @@
+package db
+
+import (
+	"gorm.io/gorm/clause"
+)
+
+// BlockTime is the Timestamp.set value of a block, in second
+type BlockTime struct {
+	BlockNumber uint64 `gorm:"primarykey;autoIncrement:false"`
+	Timestamp   int64  `gorm:"index:idx_block_time"`
+}
+
+// SaveBlockTimes saves the timestamps of blocks, blocks processed again are overwritten
+func (s *gormStore) SaveBlockTimes(times []BlockTime) error {
+	if len(times) == 0 {
+		return nil
+	}
+	return s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "block_number"}},
+		DoUpdates: clause.AssignmentColumns([]string{"timestamp"}),
+	}).CreateInBatches(times, 200).Error
+}
+
+// BlockTimeAt returns the last indexed block at or before number
+func (s *gormStore) BlockTimeAt(number uint64) (*BlockTime, error) {
+	bt := &BlockTime{}
+	err := s.db.Where("block_number <= ?", number).Order("block_number desc").First(bt).Error
+	if err != nil {
+		return nil, err
+	}
+	return bt, nil
+}
+
+// BlockAtTime returns the first indexed block produced at or after timestamp ts
+func (s *gormStore) BlockAtTime(ts int64) (*BlockTime, error) {
+	bt := &BlockTime{}
+	err := s.db.Where("timestamp >= ?", ts).Order("timestamp, block_number").First(bt).Error
+	if err != nil {
+		return nil, err
+	}
+	return bt, nil
+}
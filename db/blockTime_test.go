@@ -0,0 +1,25 @@
+package db
+
+import (
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestSqliteBlockTimes(t *testing.T) {
+	store := getSqliteStore()
+	assert.NilError(t, store.SaveBlockTimes([]BlockTime{{10, 1000}, {11, 1006}, {12, 1012}}))
+	// processing a block again overwrites it
+	assert.NilError(t, store.SaveBlockTimes([]BlockTime{{12, 1013}}))
+
+	bt, err := store.BlockTimeAt(20)
+	assert.NilError(t, err)
+	assert.Equal(t, *bt, BlockTime{12, 1013})
+	bt, err = store.BlockAtTime(1001)
+	assert.NilError(t, err)
+	assert.Equal(t, bt.BlockNumber, uint64(11))
+	_, err = store.BlockAtTime(2000)
+	assert.Assert(t, err != nil)
+	_, err = store.BlockTimeAt(5)
+	assert.Assert(t, err != nil)
+}
@@ -9,18 +9,21 @@ type CheckPoint struct {
 	CheckType int
 	Value     uint64
 	End       uint64
+	// StorageKey is the last Market.FilesV2 key loaded by the snapshot bootstrap
+	StorageKey string `gorm:"type:VARCHAR(256)"`
 }
 
 const (
 	IndexKey         = 1
 	IndexBlockNumber = 2
+	IndexStorageKey  = 3
 )
 
-func GetOrInit(start, end uint64) (uint64, error) {
+func (s *gormStore) GetOrInit(start, end uint64) (uint64, error) {
 	var cp CheckPoint
-	if err := MysqlDb.Where("check_type = ? and end = ? ", IndexKey, end).First(&cp).Error; err != nil {
+	if err := s.db.Where(map[string]interface{}{"check_type": IndexKey, "end": end}).First(&cp).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			MysqlDb.Create(&CheckPoint{CheckType: IndexKey, Value: start, End: end})
+			s.db.Create(&CheckPoint{CheckType: IndexKey, Value: start, End: end})
 			return start, nil
 		}
 		return 0, err
@@ -28,16 +31,16 @@ func GetOrInit(start, end uint64) (uint64, error) {
 	return cp.Value, nil
 }
 
-func UpdateIndexKey(value, end uint64) error {
-	return MysqlDb.Model(&CheckPoint{}).Where("check_type = ? and end = ?", IndexKey, end).
+func (s *gormStore) UpdateIndexKey(value, end uint64) error {
+	return s.db.Model(&CheckPoint{}).Where(map[string]interface{}{"check_type": IndexKey, "end": end}).
 		Update("value", value).Error
 }
 
-func GetBlockNumber() (uint64, error) {
+func (s *gormStore) GetBlockNumber() (uint64, error) {
 	var cp CheckPoint
-	if err := MysqlDb.Where("check_type = ?  ", IndexBlockNumber).First(&cp).Error; err != nil {
+	if err := s.db.Where("check_type = ?  ", IndexBlockNumber).First(&cp).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			MysqlDb.Create(&CheckPoint{CheckType: IndexBlockNumber, Value: 0})
+			s.db.Create(&CheckPoint{CheckType: IndexBlockNumber, Value: 0})
 			return 0, nil
 		} else {
 			return 0, err
@@ -46,7 +49,35 @@ func GetBlockNumber() (uint64, error) {
 	return cp.Value, nil
 }
 
-func UpdateBlockNumber(blockNumber uint64) error {
-	return MysqlDb.Model(&CheckPoint{}).Where("check_type = ?", IndexBlockNumber).
+func (s *gormStore) UpdateBlockNumber(blockNumber uint64) error {
+	return s.db.Model(&CheckPoint{}).Where("check_type = ?", IndexBlockNumber).
 		Update("value", blockNumber).Error
 }
+
+// GetStorageKey returns the last storage key loaded by the snapshot bootstrap at block end and the number of files loaded
+func (s *gormStore) GetStorageKey(end uint64) (string, uint64, error) {
+	var cp CheckPoint
+	if err := s.db.Where(map[string]interface{}{"check_type": IndexStorageKey, "end": end}).First(&cp).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return "", 0, s.db.Create(&CheckPoint{CheckType: IndexStorageKey, End: end}).Error
+		}
+		return "", 0, err
+	}
+	return cp.StorageKey, cp.Value, nil
+}
+
+func (s *gormStore) UpdateStorageKey(key string, value, end uint64) error {
+	return s.db.Model(&CheckPoint{}).Where(map[string]interface{}{"check_type": IndexStorageKey, "end": end}).
+		Updates(map[string]interface{}{"storage_key": key, "value": value}).Error
+}
+
+// SegmentCheckPoints returns the saved block of every initial fetch segment keyed by the segment end
+func (s *gormStore) SegmentCheckPoints() (map[uint64]uint64, error) {
+	var cps []CheckPoint
+	err := s.db.Where("check_type = ?", IndexKey).Find(&cps).Error
+	res := make(map[uint64]uint64, len(cps))
+	for _, cp := range cps {
+		res[cp.End] = cp.Value
+	}
+	return res, err
+}
@@ -0,0 +1,25 @@
+package db
+
+import (
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestSqliteSegmentCheckPoints(t *testing.T) {
+	store := getSqliteStore()
+	assert.NilError(t, store.Ping())
+	_, err := store.GetOrInit(0, 99)
+	assert.NilError(t, err)
+	_, err = store.GetOrInit(100, 199)
+	assert.NilError(t, err)
+	assert.NilError(t, store.UpdateIndexKey(150, 199))
+	_, err = store.GetBlockNumber()
+	assert.NilError(t, err)
+
+	cps, err := store.SegmentCheckPoints()
+	assert.NilError(t, err)
+	assert.Equal(t, len(cps), 2)
+	assert.Equal(t, cps[99], uint64(0))
+	assert.Equal(t, cps[199], uint64(150))
+}
@@ -0,0 +1,105 @@
+package db
+
+import (
+	"statistic/config"
+
+	"gorm.io/gorm"
+)
+
+const (
+	CloseReasonClosed  = "closed"
+	CloseReasonIllegal = "illegal"
+	// CloseReasonAudit is used for files the auditor found in the database but not on chain
+	CloseReasonAudit = "audit"
+)
+
+// ClosedFile archives a file_info row when the file is closed on chain
+type ClosedFile struct {
+	ID                 int    `gorm:"primarykey"`
+	Cid                string `gorm:"index:idx_closed_cid;type:VARCHAR(64)"`
+	FileSize           uint64
+	Spower             uint64
+	ExpiredAt          uint32
+	CreateAt           uint32
+	CalculatedAt       uint32
+	Amount             string `gorm:"type:VARCHAR(128)"`
+	Prepaid            string `gorm:"type:VARCHAR(128)"`
+	ReportedReplicaCnt uint32
+	RemainingPaidCnt   uint32
+	ClosedAt           uint64 `gorm:"index:idx_closed_at"`
+	Reason             string `gorm:"index:idx_closed_reason;type:VARCHAR(16)"`
+}
+
+// CloseByCid moves the file to closed_file and deletes its replicas
+func (s *gormStore) CloseByCid(cid string, closedAt uint64, reason string) error {
+	file, err := s.QueryFileByCid(cid)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil
+		}
+		return err
+	}
+	closed := &ClosedFile{
+		Cid:                file.Cid,
+		FileSize:           file.FileSize,
+		Spower:             file.Spower,
+		ExpiredAt:          file.ExpiredAt,
+		CreateAt:           file.CreateAt,
+		CalculatedAt:       file.CalculatedAt,
+		Amount:             file.Amount,
+		Prepaid:            file.Prepaid,
+		ReportedReplicaCnt: file.ReportedReplicaCnt,
+		RemainingPaidCnt:   file.RemainingPaidCnt,
+		ClosedAt:           closedAt,
+		Reason:             reason,
+	}
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Create(closed).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Delete(&Replica{}, "file_id = ?", file.ID).Error
+		if err != nil {
+			return err
+		}
+		return tx.Delete(file).Error
+	})
+}
+
+func (s *gormStore) ClosedFilesByCid(cid string) ([]ClosedFile, error) {
+	var res []ClosedFile
+	err := s.db.Where("cid = ?", cid).Order("closed_at").Find(&res).Error
+	return res, err
+}
+
+// ClosedFilesBySlot returns the number of closed files of the slot before slot by reason, pruned slots are read from the rollups
+func (s *gormStore) ClosedFilesBySlot(slot uint64) (map[string]int64, error) {
+	var rows []struct {
+		Reason string
+		Cnt    int64
+	}
+	preSlot := slot - config.SlotBlocks
+	res := map[string]int64{CloseReasonClosed: 0, CloseReasonIllegal: 0}
+	rollups, ok, err := s.slotRollups(TableClosedFile, preSlot)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		for reason, r := range rollups {
+			res[reason] = r.Cnt
+		}
+		return res, nil
+	}
+	err = s.db.Table("closed_file").
+		Select("reason, count(1) as cnt").
+		Where("closed_at >= ?", preSlot).
+		Where("closed_at < ?", slot).
+		Group("reason").Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range rows {
+		res[r.Reason] = r.Cnt
+	}
+	return res, nil
+}
@@ -0,0 +1,58 @@
+package db
+
+// ErrorFile records a file that could not be saved, it is reprocessed by the error retrier
+type ErrorFile struct {
+	ID          int    `gorm:"primarykey"`
+	Cid         string `gorm:"unique;type:VARCHAR(64)"`
+	Key         string `gorm:"type:VARCHAR(300)"`
+	BlockNumber uint64
+	Attempts    int    `gorm:"index:idx_error_attempts"`
+	LastError   string `gorm:"type:VARCHAR(512)"`
+	UpdatedAt   int64
+}
+
+const maxErrorLen = 512
+
+func (s *gormStore) SaveError(errFile *ErrorFile) error {
+	errFile.LastError = truncateError(errFile.LastError)
+	err := s.db.Create(errFile).Error
+	if err != nil && !isDuplicate(err) {
+		return err
+	}
+	return nil
+}
+
+// ListErrorFiles returns up to limit error files after id, maxAttempts 0 lists all of them
+func (s *gormStore) ListErrorFiles(afterId int, maxAttempts int, limit int) ([]ErrorFile, error) {
+	var res []ErrorFile
+	tx := s.db.Where("id > ?", afterId)
+	if maxAttempts > 0 {
+		tx = tx.Where("attempts < ?", maxAttempts)
+	}
+	err := tx.Order("id").Limit(limit).Find(&res).Error
+	return res, err
+}
+
+// MarkErrorAttempt increases the attempt count of errFile and records the failure
+func (s *gormStore) MarkErrorAttempt(errFile *ErrorFile, cause error) error {
+	errFile.Attempts++
+	errFile.LastError = truncateError(cause.Error())
+	return s.db.Model(errFile).Select("attempts", "last_error", "updated_at").Updates(errFile).Error
+}
+
+func (s *gormStore) DeleteErrorFile(id int) error {
+	return s.db.Delete(&ErrorFile{}, id).Error
+}
+
+// PurgeErrorFiles deletes the error files with at least minAttempts attempts, 0 deletes all of them
+func (s *gormStore) PurgeErrorFiles(minAttempts int) (int64, error) {
+	tx := s.db.Where("attempts >= ?", minAttempts).Delete(&ErrorFile{})
+	return tx.RowsAffected, tx.Error
+}
+
+func truncateError(msg string) string {
+	if len(msg) > maxErrorLen {
+		return msg[:maxErrorLen]
+	}
+	return msg
+}
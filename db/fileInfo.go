@@ -1,7 +1,8 @@
 package db
 
 import (
-	"github.com/go-sql-driver/mysql"
+	"statistic/config"
+
 	"gorm.io/gorm"
 )
 
@@ -23,79 +24,58 @@ type FileInfo struct {
 type Replica struct {
 	ID         int    `gorm:"primarykey"`
 	FileId     int    `gorm:"index:idx_file_id"`
-	GroupOwner string `gorm:"type:VARCHAR(64)"`
-	Who        string `gorm:"type:VARCHAR(64)"`
+	GroupOwner string `gorm:"index:idx_replica_group_owner;type:VARCHAR(64)"`
+	Who        string `gorm:"index:idx_replica_who;type:VARCHAR(64)"`
 	ValidAt    uint32
-	Anchor     string `gorm:"type:VARCHAR(130)"`
+	Anchor     string `gorm:"index:idx_replica_anchor;type:VARCHAR(130)"`
 	IsReported bool
 	CreateAt   uint32
 }
 
-type ErrorFile struct {
-	ID  int    `gorm:"primarykey"`
-	Cid string `gorm:"unique;type:VARCHAR(64)"`
-	Key string `gorm:"type:VARCHAR(300)"`
-}
-
-func SaveError(errFile *ErrorFile) error {
-	err := MysqlDb.Create(errFile).Error
-	if err != nil {
-		if merr, ok := err.(*mysql.MySQLError); ok {
-			if merr.Number != 1062 {
-				return err
-			} else {
-				return nil
-			}
-		}
-	}
-	return nil
-}
-func SaveFiles(info *FileInfo, update bool) error {
-	file, err := QueryFileByCid(info.Cid)
+func (s *gormStore) SaveFiles(info *FileInfo, update bool) error {
+	file, err := s.QueryFileByCid(info.Cid)
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
-			return InsertFiles(info)
+			return s.InsertFiles(info)
 		} else {
 			return err
 		}
 	} else if update {
 		info.ID = file.ID
 		info.CreateAt = 0
-		return UpdateFile(info)
+		return s.UpdateFile(info)
 	}
 	return nil
 }
 
-func InsertFiles(info *FileInfo) error {
-	e := MysqlDb.Transaction(func(tx *gorm.DB) error {
-		err := MysqlDb.Create(info).Error
+func (s *gormStore) InsertFiles(info *FileInfo) error {
+	e := s.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Create(info).Error
 		if err != nil {
-			if merr, ok := err.(*mysql.MySQLError); ok {
-				if merr.Number != 1062 {
-					return err
-				} else {
-					return nil
-				}
-			}
+			return err
 		}
 		for i := range info.Replicas {
 			info.Replicas[i].FileId = info.ID
 		}
-		err = MysqlDb.CreateInBatches(&info.Replicas, len(info.Replicas)).Error
+		err = tx.CreateInBatches(&info.Replicas, len(info.Replicas)).Error
 		return err
 	})
+	// the file is saved already, roll back and ignore it
+	if isDuplicate(e) {
+		return nil
+	}
 	return e
 }
 
-func UpdateFile(info *FileInfo) error {
-	return MysqlDb.Model(&FileInfo{}).Where("cid = ?", info.Cid).Updates(info).Error
+func (s *gormStore) UpdateFile(info *FileInfo) error {
+	return s.db.Model(&FileInfo{}).Where("cid = ?", info.Cid).Updates(info).Error
 }
 
-func UpdateReplicas(info *FileInfo) error {
-	file, err := QueryFileByCid(info.Cid)
+func (s *gormStore) UpdateReplicas(info *FileInfo) error {
+	file, err := s.QueryFileByCid(info.Cid)
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
-			err = MysqlDb.Create(info).Error
+			err = s.db.Create(info).Error
 			if err != nil {
 				return err
 			}
@@ -109,86 +89,133 @@ func UpdateReplicas(info *FileInfo) error {
 	for i := range info.Replicas {
 		info.Replicas[i].FileId = info.ID
 	}
-	err = MysqlDb.Transaction(func(tx *gorm.DB) error {
-		e := DeleteReplicas(info.ID)
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		txs := s.with(tx)
+		e := txs.DeleteReplicas(info.ID)
 		if e != nil {
 			return e
 		}
-		if e = MysqlDb.CreateInBatches(&info.Replicas, len(info.Replicas)).Error; e != nil {
+		if e = tx.CreateInBatches(&info.Replicas, len(info.Replicas)).Error; e != nil {
 			return e
 		}
 		info.CreateAt = 0
-		return UpdateFile(info)
+		return txs.UpdateFile(info)
 	})
 	return err
 }
 
-func QueryFileByCid(cid string) (*FileInfo, error) {
+func (s *gormStore) QueryFileByCid(cid string) (*FileInfo, error) {
 	file := &FileInfo{}
-	err := MysqlDb.Where("cid = ?", cid).First(file).Error
+	err := s.db.Where("cid = ?", cid).First(file).Error
 	if err != nil {
 		return nil, err
 	}
 	return file, nil
 }
 
-func DeleteReplicas(fileId int) error {
-	return MysqlDb.Delete(&Replica{}, "file_id = ?", fileId).Error
+// FileFilter selects files by inclusive ranges, nil bounds are open. Files are paged by id after After.
+type FileFilter struct {
+	After       int
+	Limit       int
+	MinSize     *uint64
+	MaxSize     *uint64
+	MinReplicas *uint32
+	MaxReplicas *uint32
+	CreateFrom  *uint32
+	CreateTo    *uint32
+	ExpireFrom  *uint32
+	ExpireTo    *uint32
+}
+
+// ListFiles pages through the files matching filter by id, replicas are not loaded
+func (s *gormStore) ListFiles(filter FileFilter) ([]FileInfo, error) {
+	var res []FileInfo
+	tx := s.db.Where("id > ?", filter.After)
+	if filter.MinSize != nil {
+		tx.Where("file_size >= ?", *filter.MinSize)
+	}
+	if filter.MaxSize != nil {
+		tx.Where("file_size <= ?", *filter.MaxSize)
+	}
+	if filter.MinReplicas != nil {
+		tx.Where("reported_replica_cnt >= ?", *filter.MinReplicas)
+	}
+	if filter.MaxReplicas != nil {
+		tx.Where("reported_replica_cnt <= ?", *filter.MaxReplicas)
+	}
+	if filter.CreateFrom != nil {
+		tx.Where("create_at >= ?", *filter.CreateFrom)
+	}
+	if filter.CreateTo != nil {
+		tx.Where("create_at <= ?", *filter.CreateTo)
+	}
+	if filter.ExpireFrom != nil {
+		tx.Where("expired_at >= ?", *filter.ExpireFrom)
+	}
+	if filter.ExpireTo != nil {
+		tx.Where("expired_at <= ?", *filter.ExpireTo)
+	}
+	err := tx.Order("id").Limit(filter.Limit).Find(&res).Error
+	return res, err
+}
+
+func (s *gormStore) DeleteReplicas(fileId int) error {
+	return s.db.Delete(&Replica{}, "file_id = ?", fileId).Error
 }
 
-func DeleteByCid(cid string) error {
-	file, err := QueryFileByCid(cid)
+func (s *gormStore) DeleteByCid(cid string) error {
+	file, err := s.QueryFileByCid(cid)
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return nil
 		}
 		return err
 	}
-	err = DeleteReplicas(file.ID)
+	err = s.DeleteReplicas(file.ID)
 	if err != nil {
 		return err
 	}
-	return MysqlDb.Delete(file).Error
+	return s.db.Delete(file).Error
 }
 
 //func SaveReplica(re *Replica) error {
-//	return MysqlDb.Save(re).Error
+//	return s.db.Save(re).Error
 //}
 
-func FileCnt() (int64, error) {
+func (s *gormStore) FileCnt() (int64, error) {
 	var count int64
-	err := MysqlDb.Table("file_info").Count(&count).Error
+	err := s.db.Table("file_info").Count(&count).Error
 	return count, err
 }
 
-func AvgReplicas() (float64, error) {
+func (s *gormStore) AvgReplicas() (float64, error) {
 	var avg float64
-	err := MysqlDb.Table("file_info").
+	err := s.db.Table("file_info").
 		Select("avg(reported_replica_cnt)").Scan(&avg).Error
 	return avg, err
 }
 
-func AvgReplicasBySize(low uint64, high uint64) (float64, error) {
+func (s *gormStore) AvgReplicasBySize(low uint64, high uint64) (float64, error) {
 	var avg float64
-	err := MysqlDb.Table("file_info").
+	err := s.db.Table("file_info").
 		Select("avg(reported_replica_cnt)").
 		Where("file_size >= ?", low).
 		Where("file_size < ?", high).Scan(&avg).Error
 	return avg, err
 }
 
-func AvgReplicasByCreateTime(low uint64, high uint64) (float64, error) {
+func (s *gormStore) AvgReplicasByCreateTime(low uint64, high uint64) (float64, error) {
 	var avg float64
-	err := MysqlDb.Table("file_info").
+	err := s.db.Table("file_info").
 		Select("avg(reported_replica_cnt)").
 		Where("create_at > ?", low).
 		Where("create_at <= ?", high).Scan(&avg).Error
 	return avg, err
 }
 
-func FileCntByReplicaSize(low uint64, high uint64) (int64, error) {
+func (s *gormStore) FileCntByReplicaSize(low uint64, high uint64) (int64, error) {
 	var count int64
-	tx := MysqlDb.Table("file_info")
+	tx := s.db.Table("file_info")
 	if low == 0 && high == 0 {
 		tx.Where("reported_replica_cnt = ?", 0)
 	} else {
@@ -199,57 +226,57 @@ func FileCntByReplicaSize(low uint64, high uint64) (int64, error) {
 	return count, err
 }
 
-func AvgFileSize() (float64, error) {
+func (s *gormStore) AvgFileSize() (float64, error) {
 	var avg float64
-	err := MysqlDb.Table("file_info").
+	err := s.db.Table("file_info").
 		Select("avg(file_size)").Scan(&avg).Error
 	return avg, err
 }
 
-func AvgSpower() (float64, error) {
+func (s *gormStore) AvgSpower() (float64, error) {
 	var avg float64
-	err := MysqlDb.Table("file_info").
+	err := s.db.Table("file_info").
 		Select("avg(spower)").Scan(&avg).Error
 	return avg, err
 }
 
-func FileCntBySlot(slot uint64) (int64, error) {
+func (s *gormStore) FileCntBySlot(slot uint64) (int64, error) {
 	var count int64
-	preSlot := slot - 600
-	err := MysqlDb.Table("file_info").
+	preSlot := slot - config.SlotBlocks
+	err := s.db.Table("file_info").
 		Where("create_at >= ?", preSlot).
 		Where("create_at < ?", slot).Count(&count).Error
 	return count, err
 }
 
-func FileCntBySize(low uint64, high uint64) (int64, error) {
+func (s *gormStore) FileCntBySize(low uint64, high uint64) (int64, error) {
 	var count int64
-	err := MysqlDb.Table("file_info").
+	err := s.db.Table("file_info").
 		Where("file_size >= ?", low).
 		Where("file_size < ?", high).Count(&count).Error
 	return count, err
 }
 
-func FileCntBySizeWithNoneRep(low uint64, high uint64) (int64, error) {
+func (s *gormStore) FileCntBySizeWithNoneRep(low uint64, high uint64) (int64, error) {
 	var count int64
-	err := MysqlDb.Table("file_info").
+	err := s.db.Table("file_info").
 		Where("reported_replica_cnt > 0").
 		Where("file_size >= ?", low).
 		Where("file_size < ?", high).Count(&count).Error
 	return count, err
 }
 
-func FileCntByCreateTime(low uint64, high uint64) (int64, error) {
+func (s *gormStore) FileCntByCreateTime(low uint64, high uint64) (int64, error) {
 	var count int64
-	err := MysqlDb.Table("file_info").
+	err := s.db.Table("file_info").
 		Where("create_at > ?", low).
 		Where("create_at <= ?", high).Count(&count).Error
 	return count, err
 }
 
-func FileCntByExpireTime(low uint64, high uint64) (int64, error) {
+func (s *gormStore) FileCntByExpireTime(low uint64, high uint64) (int64, error) {
 	var count int64
-	err := MysqlDb.Table("file_info").
+	err := s.db.Table("file_info").
 		Where("expired_at > ?", low).
 		Where("expired_at <= ?", high).Count(&count).Error
 	return count, err
@@ -261,14 +288,33 @@ type FileOrder struct {
 	BlockNumber uint64 `gorm:"index:idx_block_number"`
 }
 
-func SaveFileOrders(orders []FileOrder) error {
-	return MysqlDb.CreateInBatches(orders, 100).Error
+func (s *gormStore) SaveFileOrders(orders []FileOrder) error {
+	return s.db.CreateInBatches(orders, 100).Error
 }
 
-func FileOrdersBySlot(slot uint64) (int64, error) {
+// ReplaceFileOrders replaces the file orders of a block
+func (s *gormStore) ReplaceFileOrders(blockNumber uint64, orders []FileOrder) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("block_number = ?", blockNumber).Delete(&FileOrder{}).Error
+		if err != nil {
+			return err
+		}
+		if len(orders) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(orders, 100).Error
+	})
+}
+
+// FileOrdersBySlot counts the file orders of the slot before slot, pruned slots are read from the rollups
+func (s *gormStore) FileOrdersBySlot(slot uint64) (int64, error) {
 	var count int64
-	preSlot := slot - 600
-	err := MysqlDb.Table("file_order").
+	preSlot := slot - config.SlotBlocks
+	rollups, ok, err := s.slotRollups(TableFileOrder, preSlot)
+	if err != nil || ok {
+		return rollups["order"].Cnt, err
+	}
+	err = s.db.Table("file_order").
 		Where("block_number >= ?", preSlot).
 		Where("block_number < ?", slot).Count(&count).Error
 	return count, err
@@ -3,6 +3,8 @@ package db
 import (
 	"statistic/config"
 	"testing"
+
+	"gotest.tools/assert"
 )
 
 func getConfig() config.DbConfig {
@@ -17,8 +19,16 @@ func getConfig() config.DbConfig {
 	}
 }
 
+func getStore() Store {
+	store, err := NewStore(getConfig())
+	if err != nil {
+		panic(err)
+	}
+	return store
+}
+
 func TestDB(t *testing.T) {
-	InitMysql(getConfig())
+	store := getStore()
 	rep := Replica{
 		GroupOwner: "1",
 	}
@@ -29,19 +39,56 @@ func TestDB(t *testing.T) {
 		CreateAt:           0,
 		Replicas:           []Replica{rep},
 	}
-	UpdateFile(&file)
-	//UpdateReplicas(&file)
+	store.UpdateFile(&file)
+	//store.UpdateReplicas(&file)
 
 }
 
 func TestCreateErr(t *testing.T) {
-	InitMysql(getConfig())
+	store := getStore()
 	errfile := &ErrorFile{
 		Cid: "1",
 		Key: "0x",
 	}
-	err := SaveError(errfile)
+	err := store.SaveError(errfile)
 	if err != nil {
 		panic(err)
 	}
 }
+
+func TestSqliteListFiles(t *testing.T) {
+	store := getSqliteStore()
+	for _, cid := range []string{"QmA", "QmB", "QmC"} {
+		assert.NilError(t, store.SaveFiles(&FileInfo{Cid: cid, Replicas: []Replica{{Who: "a", GroupOwner: "g"}}}, false))
+	}
+	files, err := store.ListFiles(FileFilter{Limit: 2})
+	assert.NilError(t, err)
+	assert.Equal(t, len(files), 2)
+	files, err = store.ListFiles(FileFilter{After: files[1].ID, Limit: 2})
+	assert.NilError(t, err)
+	assert.Equal(t, len(files), 1)
+	assert.Equal(t, files[0].Cid, "QmC")
+
+	replicas, err := store.ReplicasByFileIds([]int{files[0].ID})
+	assert.NilError(t, err)
+	assert.Equal(t, len(replicas), 1)
+	assert.Equal(t, replicas[files[0].ID][0].GroupOwner, "g")
+}
+
+func TestSqliteFileFilter(t *testing.T) {
+	store := getSqliteStore()
+	for i, size := range []uint64{10, 100, 1000} {
+		f := &FileInfo{Cid: "Qm" + string(rune('A'+i)), FileSize: size, ReportedReplicaCnt: uint32(i), CreateAt: uint32(100 * i), ExpiredAt: 5000}
+		assert.NilError(t, store.SaveFiles(f, false))
+	}
+	minSize, maxReplicas := uint64(50), uint32(1)
+	files, err := store.ListFiles(FileFilter{Limit: 10, MinSize: &minSize, MaxReplicas: &maxReplicas})
+	assert.NilError(t, err)
+	assert.Equal(t, len(files), 1)
+	assert.Equal(t, files[0].Cid, "QmB")
+
+	createTo := uint32(100)
+	files, err = store.ListFiles(FileFilter{Limit: 10, CreateTo: &createTo})
+	assert.NilError(t, err)
+	assert.Equal(t, len(files), 2)
+}
@@ -0,0 +1,59 @@
+package db
+
+import (
+	"statistic/config"
+
+	"gorm.io/gorm"
+)
+
+// FileRenewal records a Market_RenewFileSuccess with the file values before and after the renewal
+type FileRenewal struct {
+	ID           int    `gorm:"primarykey"`
+	Cid          string `gorm:"index:idx_renewal_cid;type:VARCHAR(64)"`
+	BlockNumber  uint64 `gorm:"index:idx_renewal_block"`
+	FileSize     uint64
+	OldExpiredAt uint32
+	NewExpiredAt uint32
+	AmountDelta  string `gorm:"type:VARCHAR(128)"`
+	PrepaidDelta string `gorm:"type:VARCHAR(128)"`
+}
+
+// ReplaceFileRenewals replaces the renewals of a block
+func (s *gormStore) ReplaceFileRenewals(blockNumber uint64, renewals []FileRenewal) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("block_number = ?", blockNumber).Delete(&FileRenewal{}).Error
+		if err != nil {
+			return err
+		}
+		if len(renewals) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(renewals, 100).Error
+	})
+}
+
+func (s *gormStore) FileRenewalsByCid(cid string) ([]FileRenewal, error) {
+	var res []FileRenewal
+	err := s.db.Where("cid = ?", cid).Order("block_number").Find(&res).Error
+	return res, err
+}
+
+// RenewalsBySlot returns the number of renewals and the renewed file size of the slot before slot,
+// pruned slots are read from the rollups
+func (s *gormStore) RenewalsBySlot(slot uint64) (int64, float64, error) {
+	var res struct {
+		Cnt    int64
+		Volume float64
+	}
+	preSlot := slot - config.SlotBlocks
+	rollups, ok, err := s.slotRollups(TableFileRenewal, preSlot)
+	if err != nil || ok {
+		r := rollups["renewal"]
+		return r.Cnt, float64(r.Size), err
+	}
+	err = s.db.Table("file_renewal").
+		Select("count(1) as cnt, coalesce(sum(file_size), 0) as volume").
+		Where("block_number >= ?", preSlot).
+		Where("block_number < ?", slot).Scan(&res).Error
+	return res.Cnt, res.Volume, err
+}
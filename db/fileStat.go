@@ -0,0 +1,207 @@
+package db
+
+import (
+	"fmt"
+	"statistic/config"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	StatSize    = "size"
+	StatReplica = "replica"
+	StatExpire  = "expire"
+)
+
+// SizeBuckets are the lower bounds of the file size buckets, they line up with the size conditions of the metrics
+var SizeBuckets = []uint64{0, 1 << 10, 10 << 10, 100 << 10, 1 << 20, 10 << 20, 30 << 20, 100 << 20, 300 << 20, 1 << 30}
+
+// MaxReplicaBucket holds every file with more than MaxReplicaBucket-1 reported replicas
+const MaxReplicaBucket = 201
+
+// FileStat rolls up the files created in a slot by the size, replica or expire slot bucket of Kind.
+// The buckets of each kind add up to all files of the slot.
+type FileStat struct {
+	ID       int    `gorm:"primarykey"`
+	Slot     uint64 `gorm:"uniqueIndex:idx_file_stat"`
+	Kind     string `gorm:"uniqueIndex:idx_file_stat;type:VARCHAR(16)"`
+	Bucket   uint64 `gorm:"uniqueIndex:idx_file_stat"`
+	Files    int64
+	Bytes    int64
+	Replicas int64
+	Spower   int64
+	Reported int64 // files with at least one reported replica
+}
+
+func SizeBucket(size uint64) uint64 {
+	b := 0
+	for i, low := range SizeBuckets {
+		if size >= low {
+			b = i
+		}
+	}
+	return uint64(b)
+}
+
+func replicaBucket(cnt uint32) uint64 {
+	if cnt >= MaxReplicaBucket {
+		return MaxReplicaBucket
+	}
+	return uint64(cnt)
+}
+
+func statSlot(number uint32) uint64 {
+	return uint64(number) - uint64(number)%config.SlotBlocks
+}
+
+// fileStats returns the contribution of f to the rollups, negated if sign is -1
+func fileStats(f *FileInfo, sign int64) []FileStat {
+	base := FileStat{
+		Slot:     statSlot(f.CreateAt),
+		Files:    sign,
+		Bytes:    sign * int64(f.FileSize),
+		Replicas: sign * int64(f.ReportedReplicaCnt),
+		Spower:   sign * int64(f.Spower),
+	}
+	if f.ReportedReplicaCnt > 0 {
+		base.Reported = sign
+	}
+	size, replica, expire := base, base, base
+	size.Kind, size.Bucket = StatSize, SizeBucket(f.FileSize)
+	replica.Kind, replica.Bucket = StatReplica, replicaBucket(f.ReportedReplicaCnt)
+	expire.Kind, expire.Bucket = StatExpire, statSlot(f.ExpiredAt)
+	return []FileStat{size, replica, expire}
+}
+
+// FileStatDelta returns the rollup changes from the files olds to the files news
+func FileStatDelta(olds, news []FileInfo) []FileStat {
+	type key struct {
+		slot   uint64
+		kind   string
+		bucket uint64
+	}
+	sums := make(map[key]*FileStat)
+	add := func(stats []FileStat) {
+		for _, st := range stats {
+			k := key{st.Slot, st.Kind, st.Bucket}
+			if sum, ok := sums[k]; ok {
+				sum.Files += st.Files
+				sum.Bytes += st.Bytes
+				sum.Replicas += st.Replicas
+				sum.Spower += st.Spower
+				sum.Reported += st.Reported
+			} else {
+				st := st
+				sums[k] = &st
+			}
+		}
+	}
+	for i := range olds {
+		add(fileStats(&olds[i], -1))
+	}
+	for i := range news {
+		add(fileStats(&news[i], 1))
+	}
+	res := make([]FileStat, 0, len(sums))
+	for _, st := range sums {
+		if *st != (FileStat{Slot: st.Slot, Kind: st.Kind, Bucket: st.Bucket}) {
+			res = append(res, *st)
+		}
+	}
+	return res
+}
+
+// ApplyFileStats adds the deltas to the rollups
+func (s *gormStore) ApplyFileStats(deltas []FileStat) error {
+	for _, d := range deltas {
+		d.ID = 0
+		err := s.db.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "slot"}, {Name: "kind"}, {Name: "bucket"}},
+			DoUpdates: clause.Set{
+				{Column: clause.Column{Name: "files"}, Value: gorm.Expr("files + ?", d.Files)},
+				{Column: clause.Column{Name: "bytes"}, Value: gorm.Expr("bytes + ?", d.Bytes)},
+				{Column: clause.Column{Name: "replicas"}, Value: gorm.Expr("replicas + ?", d.Replicas)},
+				{Column: clause.Column{Name: "spower"}, Value: gorm.Expr("spower + ?", d.Spower)},
+				{Column: clause.Column{Name: "reported"}, Value: gorm.Expr("reported + ?", d.Reported)},
+			},
+		}).Create(&d).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *gormStore) QueryFilesByCids(cids []string) ([]FileInfo, error) {
+	var res []FileInfo
+	if len(cids) == 0 {
+		return res, nil
+	}
+	err := s.db.Where("cid in ?", cids).Find(&res).Error
+	return res, err
+}
+
+// WithFileStats runs fn, which changes the files of cids, and applies the change to the rollups
+func WithFileStats(store Store, cids []string, fn func() error) error {
+	olds, err := store.QueryFilesByCids(cids)
+	if err != nil {
+		return err
+	}
+	if err = fn(); err != nil {
+		return err
+	}
+	news, err := store.QueryFilesByCids(cids)
+	if err != nil {
+		return err
+	}
+	return store.ApplyFileStats(FileStatDelta(olds, news))
+}
+
+// RebuildFileStats computes the rollups from file_info again
+func (s *gormStore) RebuildFileStats() error {
+	slot := fmt.Sprintf("create_at - create_at %% %d", config.SlotBlocks)
+	var size strings.Builder
+	size.WriteString("case")
+	for i := len(SizeBuckets) - 1; i > 0; i-- {
+		size.WriteString(fmt.Sprintf(" when file_size >= %d then %d", SizeBuckets[i], i))
+	}
+	size.WriteString(" else 0 end")
+	buckets := map[string]string{
+		StatSize:    size.String(),
+		StatReplica: fmt.Sprintf("case when reported_replica_cnt >= %d then %d else reported_replica_cnt end", MaxReplicaBucket, MaxReplicaBucket),
+		StatExpire:  fmt.Sprintf("expired_at - expired_at %% %d", config.SlotBlocks),
+	}
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("1 = 1").Delete(&FileStat{}).Error
+		if err != nil {
+			return err
+		}
+		for kind, bucket := range buckets {
+			err = tx.Exec("insert into file_stat (slot, kind, bucket, files, bytes, replicas, spower, reported) "+
+				"select "+slot+", ?, "+bucket+", count(1), sum(file_size), sum(reported_replica_cnt), sum(spower), "+
+				"sum(case when reported_replica_cnt > 0 then 1 else 0 end) "+
+				"from file_info group by "+slot+", "+bucket, kind).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// FileStatSums sums the rollups of kind by bucket over the slots in [fromSlot, toSlot), toSlot 0 for no upper bound
+func (s *gormStore) FileStatSums(kind string, fromSlot, toSlot uint64) ([]FileStat, error) {
+	var res []FileStat
+	tx := s.db.Model(&FileStat{}).
+		Select("bucket, sum(files) as files, sum(bytes) as bytes, sum(replicas) as replicas, sum(spower) as spower, sum(reported) as reported").
+		Where("kind = ?", kind).
+		Where("slot >= ?", fromSlot)
+	if toSlot > 0 {
+		tx.Where("slot < ?", toSlot)
+	}
+	// buckets of removed files stay with zero counts
+	err := tx.Group("bucket").Having("sum(files) <> 0").Scan(&res).Error
+	return res, err
+}
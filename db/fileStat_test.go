@@ -0,0 +1,60 @@
+package db
+
+import (
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestSqliteFileStats(t *testing.T) {
+	store := getSqliteStore()
+	small := &FileInfo{Cid: "QmSmall", FileSize: 100, ReportedReplicaCnt: 0, Spower: 100, CreateAt: 650, ExpiredAt: 5000}
+	big := &FileInfo{Cid: "QmBig", FileSize: 2 << 30, ReportedReplicaCnt: 300, Spower: 4 << 30, CreateAt: 1300, ExpiredAt: 9000}
+	err := WithFileStats(store, []string{small.Cid, big.Cid}, func() error {
+		if err := store.SaveFiles(small, false); err != nil {
+			return err
+		}
+		return store.SaveFiles(big, false)
+	})
+	assert.NilError(t, err)
+
+	small.ReportedReplicaCnt = 3
+	small.Replicas = []Replica{{Who: "a", IsReported: true}}
+	err = WithFileStats(store, []string{small.Cid, big.Cid}, func() error {
+		if err := store.UpdateReplicas(small); err != nil {
+			return err
+		}
+		return store.CloseByCid(big.Cid, 1400, CloseReasonClosed)
+	})
+	assert.NilError(t, err)
+
+	check := func() {
+		stats, err := store.FileStatSums(StatSize, 0, 0)
+		assert.NilError(t, err)
+		assert.Equal(t, len(stats), 1)
+		assert.Equal(t, stats[0].Bucket, uint64(0))
+		assert.Equal(t, stats[0].Files, int64(1))
+		assert.Equal(t, stats[0].Replicas, int64(3))
+		assert.Equal(t, stats[0].Reported, int64(1))
+
+		stats, err = store.FileStatSums(StatReplica, 600, 1200)
+		assert.NilError(t, err)
+		assert.Equal(t, len(stats), 1)
+		assert.Equal(t, stats[0].Bucket, uint64(3))
+
+		stats, err = store.FileStatSums(StatExpire, 1200, 0)
+		assert.NilError(t, err)
+		assert.Equal(t, len(stats), 0)
+	}
+	check()
+	assert.NilError(t, store.RebuildFileStats())
+	check()
+}
+
+func TestSizeBucket(t *testing.T) {
+	assert.Equal(t, SizeBucket(0), uint64(0))
+	assert.Equal(t, SizeBucket(1023), uint64(0))
+	assert.Equal(t, SizeBucket(1024), uint64(1))
+	assert.Equal(t, SizeBucket(30<<20), uint64(6))
+	assert.Equal(t, SizeBucket(5<<30), uint64(len(SizeBuckets)-1))
+}
@@ -0,0 +1,110 @@
+package db
+
+import (
+	"fmt"
+	"statistic/config"
+
+	"gorm.io/gorm/clause"
+)
+
+// History tables that can be pruned
+const (
+	TableFileOrder    = "file_order"
+	TableReplicaEvent = "replica_event"
+	TableFileRenewal  = "file_renewal"
+	TableClosedFile   = "closed_file"
+)
+
+// historyTable describes how the rows of a history table are rolled up by slot
+type historyTable struct {
+	slot string // block number or slot column, rows are bucketed into slots and pruned by it
+	kind string // expression of the rollup kind
+	size string // expression summed into the rollup size
+}
+
+var historyTables = map[string]historyTable{
+	TableFileOrder: {"block_number", "'order'", "0"},
+	// replica events are counted by the slot of their work report, see ReplicaChurnBySlot
+	TableReplicaEvent: {"slot", "case when is_add then 'add' else 'del' end", "0"},
+	TableFileRenewal:  {"block_number", "'renewal'", "file_size"},
+	TableClosedFile:   {"closed_at", "reason", "file_size"},
+}
+
+// HistoryRollup keeps the per slot count and size of history rows before they are pruned
+type HistoryRollup struct {
+	ID     int    `gorm:"primarykey"`
+	Source string `gorm:"uniqueIndex:idx_history_rollup;type:VARCHAR(32)"`
+	Slot   uint64 `gorm:"uniqueIndex:idx_history_rollup"`
+	Kind   string `gorm:"uniqueIndex:idx_history_rollup;type:VARCHAR(16)"`
+	Cnt    int64
+	Size   int64
+}
+
+func getHistoryTable(table string) (historyTable, error) {
+	t, ok := historyTables[table]
+	if !ok {
+		return t, fmt.Errorf("unknown history table %s", table)
+	}
+	return t, nil
+}
+
+// RollupHistory rolls up the rows of table in the slots before block before, which must be the first block of a slot.
+// Slots rolled up already are kept, so a slot has to be rolled up before any of its rows is pruned.
+func (s *gormStore) RollupHistory(table string, before uint64) error {
+	t, err := getHistoryTable(table)
+	if err != nil {
+		return err
+	}
+	slot := fmt.Sprintf("%s - %s %% %d", t.slot, t.slot, config.SlotBlocks)
+	var rollups []HistoryRollup
+	err = s.db.Table(table).
+		Select(slot+" as slot, "+t.kind+" as kind, count(1) as cnt, sum("+t.size+") as size").
+		Where(t.slot+" < ?", before).
+		Group(slot + ", " + t.kind).Scan(&rollups).Error
+	if err != nil || len(rollups) == 0 {
+		return err
+	}
+	for i := range rollups {
+		rollups[i].Source = table
+	}
+	return s.db.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(rollups, 200).Error
+}
+
+// PruneHistory deletes up to limit rows of table in the slots before block before, it returns the number of deleted rows
+func (s *gormStore) PruneHistory(table string, before uint64, limit int) (int64, error) {
+	t, err := getHistoryTable(table)
+	if err != nil {
+		return 0, err
+	}
+	var ids []int
+	err = s.db.Table(table).Where(t.slot+" < ?", before).Order("id").Limit(limit).Pluck("id", &ids).Error
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+	res := s.db.Exec("delete from "+table+" where id in ?", ids)
+	return res.RowsAffected, res.Error
+}
+
+// HistoryRollups returns the rollups of table in the slots [fromSlot, toSlot)
+func (s *gormStore) HistoryRollups(table string, fromSlot, toSlot uint64) ([]HistoryRollup, error) {
+	var res []HistoryRollup
+	err := s.db.Where("source = ?", table).
+		Where("slot >= ?", fromSlot).
+		Where("slot < ?", toSlot).
+		Order("slot").Find(&res).Error
+	return res, err
+}
+
+// slotRollups returns the rollups of table in the slot starting at preSlot keyed by kind,
+// ok is false if the slot was not rolled up and has to be counted from the rows of table
+func (s *gormStore) slotRollups(table string, preSlot uint64) (map[string]HistoryRollup, bool, error) {
+	rollups, err := s.HistoryRollups(table, preSlot, preSlot+config.SlotBlocks)
+	if err != nil || len(rollups) == 0 {
+		return nil, false, err
+	}
+	res := make(map[string]HistoryRollup, len(rollups))
+	for _, r := range rollups {
+		res[r.Kind] = r
+	}
+	return res, true, nil
+}
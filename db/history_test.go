@@ -0,0 +1,57 @@
+package db
+
+import (
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestSqliteHistoryRetention(t *testing.T) {
+	store := getSqliteStore()
+	assert.NilError(t, store.SaveFileOrders([]FileOrder{{Cid: "QmA", BlockNumber: 10}, {Cid: "QmB", BlockNumber: 610}, {Cid: "QmC", BlockNumber: 1300}}))
+	assert.NilError(t, store.ReplaceReplicaEvents(20, []ReplicaEvent{{Cid: "QmA", BlockNumber: 20, IsAdd: true}, {Cid: "QmA", BlockNumber: 20}}))
+	// a report of slot 0 included in a block of the next slot
+	assert.NilError(t, store.ReplaceReplicaEvents(610, []ReplicaEvent{{Cid: "QmB", Slot: 0, BlockNumber: 610, IsAdd: true}}))
+
+	assert.NilError(t, store.RollupHistory(TableFileOrder, 1200))
+	pruned, err := store.PruneHistory(TableFileOrder, 1200, 1)
+	assert.NilError(t, err)
+	assert.Equal(t, pruned, int64(1))
+	pruned, err = store.PruneHistory(TableFileOrder, 1200, 10)
+	assert.NilError(t, err)
+	assert.Equal(t, pruned, int64(1))
+	// rollups are kept once the rows are gone
+	assert.NilError(t, store.RollupHistory(TableFileOrder, 1200))
+	rollups, err := store.HistoryRollups(TableFileOrder, 0, 1200)
+	assert.NilError(t, err)
+	assert.Equal(t, len(rollups), 2)
+	assert.Equal(t, rollups[1].Slot, uint64(600))
+	assert.Equal(t, rollups[1].Cnt, int64(1))
+	cnt, err := store.FileOrdersBySlot(1800)
+	assert.NilError(t, err)
+	assert.Equal(t, cnt, int64(1))
+	// the slot handlers read pruned slots from the rollups
+	cnt, err = store.FileOrdersBySlot(1200)
+	assert.NilError(t, err)
+	assert.Equal(t, cnt, int64(1))
+
+	added, deleted, err := store.ReplicaChurnBySlot(600)
+	assert.NilError(t, err)
+	assert.Equal(t, added, int64(2))
+	assert.Equal(t, deleted, int64(1))
+	assert.NilError(t, store.RollupHistory(TableReplicaEvent, 600))
+	rollups, err = store.HistoryRollups(TableReplicaEvent, 0, 600)
+	assert.NilError(t, err)
+	assert.Equal(t, len(rollups), 2)
+	pruned, err = store.PruneHistory(TableReplicaEvent, 600, 10)
+	assert.NilError(t, err)
+	assert.Equal(t, pruned, int64(3))
+	// the churn of the slot is the same once it is pruned
+	added, deleted, err = store.ReplicaChurnBySlot(600)
+	assert.NilError(t, err)
+	assert.Equal(t, added, int64(2))
+	assert.Equal(t, deleted, int64(1))
+
+	_, err = store.PruneHistory("file_info", 600, 10)
+	assert.Assert(t, err != nil)
+}
@@ -0,0 +1,131 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ChainSafe/log15"
+	"gorm.io/gorm"
+)
+
+// Migration is one versioned schema change. Up and Down may run any Go code, e.g. to backfill data.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error // nil if the migration can not be reverted
+}
+
+// SchemaVersion records an applied migration
+type SchemaVersion struct {
+	Version   int `gorm:"primarykey;autoIncrement:false"`
+	Name      string
+	AppliedAt int64
+}
+
+// MigrationState is a migration with the time it was applied, 0 if it is pending
+type MigrationState struct {
+	Version   int
+	Name      string
+	AppliedAt int64
+}
+
+var ErrIrreversible = errors.New("migration can not be reverted")
+
+func (s *gormStore) appliedVersions() (map[int]SchemaVersion, error) {
+	if err := s.db.Migrator().AutoMigrate(&SchemaVersion{}); err != nil {
+		return nil, err
+	}
+	var versions []SchemaVersion
+	if err := s.db.Find(&versions).Error; err != nil {
+		return nil, err
+	}
+	res := make(map[int]SchemaVersion, len(versions))
+	for _, v := range versions {
+		res[v.Version] = v
+	}
+	return res, nil
+}
+
+// MigrateUp applies the pending migrations up to version target, 0 for all of them
+func (s *gormStore) MigrateUp(target int) error {
+	applied, err := s.appliedVersions()
+	if err != nil {
+		return err
+	}
+	for _, m := range migrations {
+		if target > 0 && m.Version > target {
+			break
+		}
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		log15.Info("apply migration", "version", m.Version, "name", m.Name)
+		err = s.db.Transaction(func(tx *gorm.DB) error {
+			if err := m.Up(tx); err != nil {
+				return err
+			}
+			return tx.Create(&SchemaVersion{Version: m.Version, Name: m.Name, AppliedAt: time.Now().Unix()}).Error
+		})
+		if err != nil {
+			return fmt.Errorf("migration %d %s: %w", m.Version, m.Name, err)
+		}
+	}
+	return nil
+}
+
+// MigrateDown reverts the last steps applied migrations
+func (s *gormStore) MigrateDown(steps int) error {
+	applied, err := s.appliedVersions()
+	if err != nil {
+		return err
+	}
+	for i := len(migrations) - 1; i >= 0 && steps > 0; i-- {
+		m := migrations[i]
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+		if m.Down == nil {
+			return fmt.Errorf("migration %d %s: %w", m.Version, m.Name, ErrIrreversible)
+		}
+		log15.Info("revert migration", "version", m.Version, "name", m.Name)
+		err = s.db.Transaction(func(tx *gorm.DB) error {
+			if err := m.Down(tx); err != nil {
+				return err
+			}
+			return tx.Delete(&SchemaVersion{}, m.Version).Error
+		})
+		if err != nil {
+			return fmt.Errorf("migration %d %s: %w", m.Version, m.Name, err)
+		}
+		steps--
+	}
+	return nil
+}
+
+func (s *gormStore) MigrationStatus() ([]MigrationState, error) {
+	applied, err := s.appliedVersions()
+	if err != nil {
+		return nil, err
+	}
+	res := make([]MigrationState, 0, len(migrations))
+	for _, m := range migrations {
+		res = append(res, MigrationState{m.Version, m.Name, applied[m.Version].AppliedAt})
+	}
+	return res, nil
+}
+
+// autoMigrate creates the tables of models or adds their missing columns and indexes
+func autoMigrate(models ...interface{}) func(tx *gorm.DB) error {
+	return func(tx *gorm.DB) error {
+		return tx.Migrator().AutoMigrate(models...)
+	}
+}
+
+// dropTables drops the tables of models
+func dropTables(models ...interface{}) func(tx *gorm.DB) error {
+	return func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(models...)
+	}
+}
@@ -0,0 +1,53 @@
+package db
+
+import (
+	"errors"
+	"statistic/config"
+	"testing"
+
+	"gorm.io/gorm"
+	"gotest.tools/assert"
+)
+
+func TestSqliteMigrations(t *testing.T) {
+	defer func(saved []Migration) { migrations = saved }(migrations)
+	migrations = append(migrations[:len(migrations):len(migrations)], Migration{
+		Version: 100,
+		Name:    "backfill test",
+		Up: func(tx *gorm.DB) error {
+			return tx.Create(&CheckPoint{CheckType: IndexBlockNumber, Value: 42}).Error
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Where("check_type = ?", IndexBlockNumber).Delete(&CheckPoint{}).Error
+		},
+	})
+
+	store, err := OpenStore(config.DbConfig{Type: TypeSqlite, Name: ":memory:"})
+	assert.NilError(t, err)
+	states, err := store.MigrationStatus()
+	assert.NilError(t, err)
+	assert.Equal(t, len(states), len(migrations))
+	assert.Equal(t, states[0].AppliedAt, int64(0))
+
+	assert.NilError(t, store.MigrateUp(1))
+	states, err = store.MigrationStatus()
+	assert.NilError(t, err)
+	assert.Assert(t, states[0].AppliedAt > 0)
+	assert.Equal(t, states[1].AppliedAt, int64(0))
+
+	assert.NilError(t, store.MigrateUp(0))
+	bn, err := store.GetBlockNumber()
+	assert.NilError(t, err)
+	assert.Equal(t, bn, uint64(42))
+
+	assert.NilError(t, store.MigrateDown(1))
+	states, err = store.MigrationStatus()
+	assert.NilError(t, err)
+	assert.Equal(t, states[len(states)-1].AppliedAt, int64(0))
+	bn, err = store.GetBlockNumber()
+	assert.NilError(t, err)
+	assert.Equal(t, bn, uint64(0))
+
+	err = store.MigrateDown(len(migrations))
+	assert.Assert(t, errors.Is(err, ErrIrreversible))
+}
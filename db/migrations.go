@@ -0,0 +1,110 @@
+package db
+
+import (
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// migrations are applied in order of Version. Append new ones at the end and never edit an applied one.
+var migrations = []Migration{
+	{
+		// Tables that existed before versioned migrations, it is a no-op on databases created by AutoMigrate
+		Version: 1,
+		Name:    "initial schema",
+		Up: autoMigrate(
+			&CheckPoint{},
+			&FileInfo{},
+			&Replica{},
+			&ErrorFile{},
+			&WorkReport{},
+			&SworkerGroup{},
+			&PubKey{},
+			&FileOrder{},
+			&ReplicaEvent{},
+			&FileRenewal{},
+			&ClosedFile{},
+			&SworkerSnapshot{},
+		),
+	},
+	{
+		// pub_key shared the idx_anchor name with work_report, mysql databases still carry the old index
+		Version: 2,
+		Name:    "drop pub_key idx_anchor",
+		Up: func(tx *gorm.DB) error {
+			if tx.Migrator().HasIndex(&PubKey{}, "idx_anchor") {
+				return tx.Migrator().DropIndex(&PubKey{}, "idx_anchor")
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			return nil
+		},
+	},
+	{
+		// file_stat rolls up file_info per slot, it is filled from the existing files
+		Version: 3,
+		Name:    "file stat rollups",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.Migrator().AutoMigrate(&FileStat{}); err != nil {
+				return err
+			}
+			return (&gormStore{db: tx}).RebuildFileStats()
+		},
+		Down: dropTables(&FileStat{}),
+	},
+	{
+		// the snapshot bootstrap keeps its resume key in check_point
+		Version: 4,
+		Name:    "check_point storage_key",
+		Up:      autoMigrate(&CheckPoint{}),
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropColumn(&CheckPoint{}, "StorageKey")
+		},
+	},
+	{
+		// replicas are looked up by storage provider, sharding adds the indexes to every shard table
+		Version: 5,
+		Name:    "replica provider indexes",
+		Up:      autoMigrate(&Replica{}),
+		Down: func(tx *gorm.DB) error {
+			tables, err := tx.Migrator().GetTables()
+			if err != nil {
+				return err
+			}
+			for _, table := range tables {
+				if table != "replica" && !strings.HasPrefix(table, "replica_") {
+					continue
+				}
+				for _, index := range []string{"idx_replica_who", "idx_replica_group_owner", "idx_replica_anchor"} {
+					m := tx.Table(table).Migrator()
+					if !m.HasIndex(table, index) {
+						continue
+					}
+					if err = m.DropIndex(table, index); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version: 6,
+		Name:    "history rollups",
+		Up:      autoMigrate(&HistoryRollup{}),
+		Down:    dropTables(&HistoryRollup{}),
+	},
+	{
+		Version: 7,
+		Name:    "block time",
+		Up:      autoMigrate(&BlockTime{}),
+		Down:    dropTables(&BlockTime{}),
+	},
+	{
+		Version: 8,
+		Name:    "group members",
+		Up:      autoMigrate(&GroupMember{}),
+		Down:    dropTables(&GroupMember{}),
+	},
+}
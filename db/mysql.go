@@ -2,23 +2,11 @@ package db
 
 import (
 	"fmt"
-	"github.com/ChainSafe/log15"
 	"gorm.io/driver/mysql"
-	"gorm.io/gorm"
-	"gorm.io/gorm/schema"
-	"gorm.io/sharding"
 	"statistic/config"
 )
 
-var MysqlDb *gorm.DB
-
-func InitMysql(config config.DbConfig) {
-	gormConfig := &gorm.Config{
-		NamingStrategy: schema.NamingStrategy{
-			SingularTable: true,
-		},
-	}
-
+func NewMysqlStore(config config.DbConfig) (Store, error) {
 	dbUri := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8&parseTime=True&loc=Asia%%2fShanghai&timeout=30s",
 		config.User,
 		config.Password,
@@ -34,37 +22,5 @@ func InitMysql(config config.DbConfig) {
 		DontSupportRenameColumn:   true,  // `change` when rename column, rename column not supported before MySQL 8, MariaDB
 		SkipInitializeWithVersion: false, // auto configure based on currently MySQL version
 	})
-	var err error
-	MysqlDb, err = gorm.Open(dialector, gormConfig)
-	if nil != err {
-		log15.Error("models.Setup err: %v", err)
-	}
-
-	middleware := sharding.Register(sharding.Config{
-		ShardingKey:         "file_id",
-		NumberOfShards:      uint(config.NumberShard),
-		PrimaryKeyGenerator: sharding.PKSnowflake,
-	}, "replica")
-	MysqlDb.Use(middleware)
-
-	if err = Migrator(); err != nil {
-		log15.Error("migrator err: %v", err)
-	}
-	log15.Info("complete init db")
-}
-
-func Migrator() error {
-	if err := MysqlDb.Migrator().AutoMigrate(
-		&CheckPoint{},
-		&FileInfo{},
-		&Replica{},
-		&ErrorFile{},
-		&WorkReport{},
-		&SworkerGroup{},
-		&PubKey{},
-		&FileOrder{},
-	); err != nil {
-		return err
-	}
-	return nil
+	return openStore(dialector, config)
 }
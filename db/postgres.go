@@ -0,0 +1,17 @@
+package db
+
+import (
+	"fmt"
+	"gorm.io/driver/postgres"
+	"statistic/config"
+)
+
+func NewPostgresStore(config config.DbConfig) (Store, error) {
+	dsn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable TimeZone=Asia/Shanghai",
+		config.IP,
+		config.Port,
+		config.User,
+		config.Password,
+		config.Name)
+	return openStore(postgres.Open(dsn), config)
+}
@@ -0,0 +1,208 @@
+package db
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Replica columns that identify a storage provider
+const (
+	ProviderWho        = "who"
+	ProviderGroupOwner = "group_owner"
+	ProviderAnchor     = "anchor"
+)
+
+// ProviderStat aggregates the replicas stored by one account or anchor
+type ProviderStat struct {
+	Provider   string
+	Files      int64
+	Bytes      int64
+	Reported   int64
+	Unreported int64
+}
+
+func (p *ProviderStat) add(o ProviderStat) {
+	p.Files += o.Files
+	p.Bytes += o.Bytes
+	p.Reported += o.Reported
+	p.Unreported += o.Unreported
+}
+
+func providerColumn(by string) (string, error) {
+	switch by {
+	case ProviderWho, ProviderGroupOwner, ProviderAnchor:
+		return by, nil
+	}
+	return "", fmt.Errorf("unknown provider column %s", by)
+}
+
+// providerQuery selects the providers aggregated by providerStats
+type providerQuery struct {
+	providers []string // only these providers if not empty
+	limit     int      // only the limit providers storing the most bytes if positive
+	minBytes  int64    // only the providers storing at least minBytes
+}
+
+// providerStats aggregates the replicas of table by the provider column.
+// A file is stored in a single shard, so the results of each shard add up.
+func (s *gormStore) providerStats(table, column string, q providerQuery) ([]ProviderStat, error) {
+	var res []ProviderStat
+	tx := s.db.Table(table + " r").
+		Select("r." + column + " as provider, count(distinct r.file_id) as files, sum(f.file_size) as bytes, " +
+			"sum(case when r.is_reported then 1 else 0 end) as reported, " +
+			"sum(case when r.is_reported then 0 else 1 end) as unreported").
+		Joins("join file_info f on f.id = r.file_id")
+	if len(q.providers) > 0 {
+		tx.Where("r."+column+" in ?", q.providers)
+	}
+	tx.Group("r." + column)
+	if q.minBytes > 0 {
+		tx.Having("sum(f.file_size) >= ?", q.minBytes)
+	}
+	if q.limit > 0 {
+		tx.Order("bytes desc").Order("provider").Limit(q.limit)
+	}
+	err := tx.Scan(&res).Error
+	return res, err
+}
+
+// ProviderStats returns the files, bytes and replicas stored by provider, by is one of the Provider columns
+func (s *gormStore) ProviderStats(by string, provider string) (*ProviderStat, error) {
+	column, err := providerColumn(by)
+	if err != nil {
+		return nil, err
+	}
+	sum := &ProviderStat{Provider: provider}
+	for _, table := range s.replicaTables() {
+		stats, err := s.providerStats(table, column, providerQuery{providers: []string{provider}})
+		if err != nil {
+			return nil, err
+		}
+		for _, st := range stats {
+			sum.add(st)
+		}
+	}
+	return sum, nil
+}
+
+// TopProviders returns the limit providers storing the most bytes, by is one of the Provider columns.
+// Sharded replicas are merged without loading every provider: the top limit of each shard give a lower bound
+// of the limit-th total, any provider reaching it stores at least bound/shards bytes in some shard,
+// and only the totals of those candidates are summed up over all the shards.
+func (s *gormStore) TopProviders(by string, limit int) ([]ProviderStat, error) {
+	column, err := providerColumn(by)
+	if err != nil {
+		return nil, err
+	}
+	tables := s.replicaTables()
+	sums := make(map[string]*ProviderStat)
+	for _, table := range tables {
+		stats, err := s.providerStats(table, column, providerQuery{limit: limit})
+		if err != nil {
+			return nil, err
+		}
+		addProviderStats(sums, stats)
+	}
+	if limit > 0 && len(tables) > 1 && len(sums) > 0 {
+		candidates, err := s.topProviderCandidates(tables, column, sums, limit)
+		if err != nil {
+			return nil, err
+		}
+		sums = make(map[string]*ProviderStat, len(candidates))
+		for _, table := range tables {
+			stats, err := s.providerStats(table, column, providerQuery{providers: candidates})
+			if err != nil {
+				return nil, err
+			}
+			addProviderStats(sums, stats)
+		}
+	}
+	res := make([]ProviderStat, 0, len(sums))
+	for _, sum := range sums {
+		res = append(res, *sum)
+	}
+	sortProviderStats(res)
+	if limit > 0 && len(res) > limit {
+		res = res[:limit]
+	}
+	return res, nil
+}
+
+// topProviderCandidates returns every provider that may be in the top limit, partial are the sums of the top of each shard
+func (s *gormStore) topProviderCandidates(tables []string, column string, partial map[string]*ProviderStat, limit int) ([]string, error) {
+	seen := make(map[string]bool, len(partial))
+	candidates := make([]string, 0, len(partial))
+	for provider := range partial {
+		seen[provider] = true
+		candidates = append(candidates, provider)
+	}
+	if len(partial) < limit {
+		// fewer providers than limit in the tops, every shard returned all of its providers
+		return candidates, nil
+	}
+	lower := make([]ProviderStat, 0, len(partial))
+	for _, sum := range partial {
+		lower = append(lower, *sum)
+	}
+	sortProviderStats(lower)
+	// the limit-th partial sum is a lower bound of the limit-th total
+	bound := lower[limit-1].Bytes
+	minBytes := bound / int64(len(tables))
+	if minBytes*int64(len(tables)) < bound {
+		minBytes++
+	}
+	for _, table := range tables {
+		stats, err := s.providerStats(table, column, providerQuery{minBytes: minBytes})
+		if err != nil {
+			return nil, err
+		}
+		for _, st := range stats {
+			if !seen[st.Provider] {
+				seen[st.Provider] = true
+				candidates = append(candidates, st.Provider)
+			}
+		}
+	}
+	return candidates, nil
+}
+
+func sortProviderStats(stats []ProviderStat) {
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Bytes != stats[j].Bytes {
+			return stats[i].Bytes > stats[j].Bytes
+		}
+		return stats[i].Provider < stats[j].Provider
+	})
+}
+
+func addProviderStats(sums map[string]*ProviderStat, stats []ProviderStat) {
+	for _, st := range stats {
+		sum, ok := sums[st.Provider]
+		if !ok {
+			sum = &ProviderStat{Provider: st.Provider}
+			sums[st.Provider] = sum
+		}
+		sum.add(st)
+	}
+}
+
+// ReplicasByProvider returns up to limit replicas stored by provider, by is one of the Provider columns
+func (s *gormStore) ReplicasByProvider(by string, provider string, limit int) ([]Replica, error) {
+	column, err := providerColumn(by)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]Replica, 0)
+	for _, table := range s.replicaTables() {
+		var replicas []Replica
+		err = s.db.Table(table).Where(column+" = ?", provider).Order("file_id").Limit(limit - len(res)).Find(&replicas).Error
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, replicas...)
+		if len(res) >= limit {
+			break
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,70 @@
+package db
+
+import (
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestSqliteProviders(t *testing.T) {
+	store := getSqliteStore()
+	assert.NilError(t, store.SaveFiles(&FileInfo{Cid: "QmA", FileSize: 100, Replicas: []Replica{
+		{Who: "a", GroupOwner: "g1", Anchor: "0x01", IsReported: true},
+		{Who: "b", GroupOwner: "g2", Anchor: "0x02", IsReported: false},
+	}}, false))
+	assert.NilError(t, store.SaveFiles(&FileInfo{Cid: "QmB", FileSize: 300, Replicas: []Replica{
+		{Who: "b", GroupOwner: "g2", Anchor: "0x02", IsReported: true},
+	}}, false))
+
+	st, err := store.ProviderStats(ProviderWho, "b")
+	assert.NilError(t, err)
+	assert.Equal(t, *st, ProviderStat{Provider: "b", Files: 2, Bytes: 400, Reported: 1, Unreported: 1})
+
+	top, err := store.TopProviders(ProviderGroupOwner, 1)
+	assert.NilError(t, err)
+	assert.Equal(t, len(top), 1)
+	assert.Equal(t, top[0].Provider, "g2")
+
+	replicas, err := store.ReplicasByProvider(ProviderAnchor, "0x01", 10)
+	assert.NilError(t, err)
+	assert.Equal(t, len(replicas), 1)
+
+	_, err = store.TopProviders("file_id", 1)
+	assert.Assert(t, err != nil)
+}
+
+func TestSqliteTopProvidersSharded(t *testing.T) {
+	s := getSqliteStore().(*gormStore)
+	// the shard tables are created by hand, gorm sharding only runs on mysql
+	store := &gormStore{db: s.db, shards: 2}
+	for _, table := range store.replicaTables() {
+		assert.NilError(t, s.db.Exec("create table "+table+" as select * from replica where 0").Error)
+	}
+	assert.NilError(t, s.db.Create(&FileInfo{ID: 1, Cid: "QmA", FileSize: 100}).Error)
+	assert.NilError(t, s.db.Create(&FileInfo{ID: 2, Cid: "QmB", FileSize: 10}).Error)
+	assert.NilError(t, s.db.Create(&FileInfo{ID: 3, Cid: "QmC", FileSize: 50}).Error)
+	assert.NilError(t, s.db.Create(&FileInfo{ID: 4, Cid: "QmD", FileSize: 100}).Error)
+	assert.NilError(t, s.db.Create(&FileInfo{ID: 5, Cid: "QmE", FileSize: 95}).Error)
+	assert.NilError(t, s.db.Create(&FileInfo{ID: 6, Cid: "QmF", FileSize: 95}).Error)
+	// shard 0 tops a, shard 1 tops b, c is second in both shards but stores the most bytes over all
+	replicas := map[string][]Replica{
+		"replica_0": {{ID: 1, FileId: 4, Who: "a"}, {ID: 2, FileId: 2, Who: "b"}, {ID: 5, FileId: 6, Who: "c"}},
+		"replica_1": {{ID: 3, FileId: 1, Who: "b"}, {ID: 4, FileId: 3, Who: "b"}, {ID: 6, FileId: 5, Who: "c"}},
+	}
+	for table, rows := range replicas {
+		assert.NilError(t, s.db.Table(table).Create(&rows).Error)
+	}
+
+	top, err := store.TopProviders(ProviderWho, 1)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, top, []ProviderStat{{Provider: "c", Files: 2, Bytes: 190, Unreported: 2}})
+	top, err = store.TopProviders(ProviderWho, 2)
+	assert.NilError(t, err)
+	assert.Equal(t, len(top), 2)
+	// the bytes of b in shard 0 are summed up although b is not in the top of shard 0
+	assert.Equal(t, top[1], ProviderStat{Provider: "b", Files: 3, Bytes: 160, Unreported: 3})
+	top, err = store.TopProviders(ProviderWho, 0)
+	assert.NilError(t, err)
+	assert.Equal(t, len(top), 3)
+	assert.Equal(t, top[2], ProviderStat{Provider: "a", Files: 1, Bytes: 100, Unreported: 1})
+}
@@ -0,0 +1,173 @@
+package db
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// fileUpdateColumns are overwritten when a file is upserted, create_at keeps the value of the first save
+var fileUpdateColumns = []string{"file_size", "spower", "expired_at", "calculated_at", "amount", "prepaid",
+	"reported_replica_cnt", "remaining_paid_cnt"}
+
+// replicaTable returns the table holding the replicas of fileId, it follows the default algorithm of gorm sharding
+func (s *gormStore) replicaTable(fileId int) string {
+	if s.shards <= 0 {
+		return "replica"
+	}
+	format := "_%04d"
+	if s.shards < 10 {
+		format = "_%01d"
+	} else if s.shards < 100 {
+		format = "_%02d"
+	} else if s.shards < 1000 {
+		format = "_%03d"
+	}
+	return "replica" + fmt.Sprintf(format, fileId%s.shards)
+}
+
+// replicaTables returns every table holding replicas
+func (s *gormStore) replicaTables() []string {
+	if s.shards <= 0 {
+		return []string{"replica"}
+	}
+	tables := make([]string, 0, s.shards)
+	for i := 0; i < s.shards; i++ {
+		tables = append(tables, s.replicaTable(i))
+	}
+	return tables
+}
+
+// UpdateReplicasBatch saves many files with their replicas in a few statements.
+// Files are upserted by cid, replicas are diffed against the saved ones per shard table
+// and only the changed replicas are deleted and inserted again.
+func (s *gormStore) UpdateReplicasBatch(infos []*FileInfo) error {
+	if len(infos) == 0 {
+		return nil
+	}
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "cid"}},
+			DoUpdates: clause.AssignmentColumns(fileUpdateColumns),
+		}).CreateInBatches(infos, 200).Error
+		if err != nil {
+			return err
+		}
+
+		// ids returned by an upsert are not reliable, read them again
+		cids := make([]string, 0, len(infos))
+		for _, info := range infos {
+			cids = append(cids, info.Cid)
+		}
+		var saved []FileInfo
+		err = tx.Select("id", "cid").Where("cid in ?", cids).Find(&saved).Error
+		if err != nil {
+			return err
+		}
+		ids := make(map[string]int, len(saved))
+		for _, f := range saved {
+			ids[f.Cid] = f.ID
+		}
+
+		shards := make(map[string][]*FileInfo)
+		for _, info := range infos {
+			id, ok := ids[info.Cid]
+			if !ok {
+				return fmt.Errorf("file %s not found after upsert", info.Cid)
+			}
+			info.ID = id
+			table := s.replicaTable(id)
+			shards[table] = append(shards[table], info)
+		}
+		txs := s.with(tx)
+		for table, files := range shards {
+			err = txs.updateShardReplicas(table, files)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// updateShardReplicas replaces the replicas of files that are stored in the same shard table
+func (s *gormStore) updateShardReplicas(table string, files []*FileInfo) error {
+	fileIds := make([]int, 0, len(files))
+	for _, f := range files {
+		fileIds = append(fileIds, f.ID)
+	}
+	var olds []Replica
+	err := s.db.Table(table).Where("file_id in ?", fileIds).Find(&olds).Error
+	if err != nil {
+		return err
+	}
+	// replicas are keyed by group owner on chain
+	saved := make(map[int]map[string]Replica, len(files))
+	for _, r := range olds {
+		if saved[r.FileId] == nil {
+			saved[r.FileId] = make(map[string]Replica)
+		}
+		saved[r.FileId][r.GroupOwner] = r
+	}
+
+	inserts := make([]Replica, 0)
+	deletes := make([]int, 0)
+	for _, f := range files {
+		olds := saved[f.ID]
+		for _, r := range f.Replicas {
+			r.FileId = f.ID
+			old, ok := olds[r.GroupOwner]
+			if ok {
+				delete(olds, r.GroupOwner)
+				r.ID = old.ID
+				if r == old {
+					continue
+				}
+				// changed replicas are deleted and inserted again
+				deletes = append(deletes, old.ID)
+				r.ID = 0
+			}
+			inserts = append(inserts, r)
+		}
+		for _, r := range olds {
+			deletes = append(deletes, r.ID)
+		}
+	}
+
+	if len(deletes) > 0 {
+		err = s.db.Table(table).Where("id in ?", deletes).Delete(&Replica{}).Error
+		if err != nil {
+			return err
+		}
+	}
+	if len(inserts) > 0 {
+		// inserts go through the replica table so that sharding fills the primary keys
+		err = s.db.CreateInBatches(inserts, 200).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReplicasByFileIds returns the replicas of the files by file id, they are read from each shard table
+func (s *gormStore) ReplicasByFileIds(fileIds []int) (map[int][]Replica, error) {
+	shards := make(map[string][]int)
+	for _, id := range fileIds {
+		table := s.replicaTable(id)
+		shards[table] = append(shards[table], id)
+	}
+	res := make(map[int][]Replica, len(fileIds))
+	for table, ids := range shards {
+		var replicas []Replica
+		err := s.db.Table(table).Where("file_id in ?", ids).Find(&replicas).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range replicas {
+			res[r.FileId] = append(res[r.FileId], r)
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,77 @@
+package db
+
+import (
+	"statistic/config"
+
+	"gorm.io/gorm"
+)
+
+// ReplicaEvent records a file added to or deleted from a sworker by a work report
+type ReplicaEvent struct {
+	ID          int    `gorm:"primarykey"`
+	Cid         string `gorm:"index:idx_replica_event_cid;type:VARCHAR(64)"`
+	Anchor      string `gorm:"index:idx_replica_event_anchor;type:VARCHAR(130)"`
+	Reporter    string `gorm:"type:VARCHAR(64)"`
+	Slot        uint64 `gorm:"index:idx_replica_event_slot"`
+	BlockNumber uint64 `gorm:"index:idx_replica_event_block"`
+	IsAdd       bool
+}
+
+// ReplaceReplicaEvents replaces the replica events of a block
+func (s *gormStore) ReplaceReplicaEvents(blockNumber uint64, events []ReplicaEvent) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("block_number = ?", blockNumber).Delete(&ReplicaEvent{}).Error
+		if err != nil {
+			return err
+		}
+		if len(events) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(events, 500).Error
+	})
+}
+
+func (s *gormStore) ReplicaEventsByCid(cid string) ([]ReplicaEvent, error) {
+	var res []ReplicaEvent
+	err := s.db.Where("cid = ?", cid).Order("block_number").Find(&res).Error
+	return res, err
+}
+
+func (s *gormStore) ReplicaEventsByAnchor(anchor string, cid string) ([]ReplicaEvent, error) {
+	var res []ReplicaEvent
+	tx := s.db.Where("anchor = ?", anchor)
+	if cid != "" {
+		tx = tx.Where("cid = ?", cid)
+	}
+	err := tx.Order("block_number").Find(&res).Error
+	return res, err
+}
+
+// ReplicaChurnBySlot counts the replicas added and deleted by work reports of the slot before slot,
+// pruned slots are read from the rollups
+func (s *gormStore) ReplicaChurnBySlot(slot uint64) (int64, int64, error) {
+	var res []struct {
+		IsAdd bool
+		Cnt   int64
+	}
+	rollups, ok, err := s.slotRollups(TableReplicaEvent, slot-config.SlotBlocks)
+	if err != nil || ok {
+		return rollups["add"].Cnt, rollups["del"].Cnt, err
+	}
+	err = s.db.Table("replica_event").
+		Select("is_add, count(1) as cnt").
+		Where("slot = ?", slot-config.SlotBlocks).
+		Group("is_add").Scan(&res).Error
+	if err != nil {
+		return 0, 0, err
+	}
+	var added, deleted int64
+	for _, r := range res {
+		if r.IsAdd {
+			added = r.Cnt
+		} else {
+			deleted = r.Cnt
+		}
+	}
+	return added, deleted, nil
+}
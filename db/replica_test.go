@@ -0,0 +1,55 @@
+package db
+
+import (
+	"statistic/config"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func testUpdateReplicasBatch(t *testing.T, store Store) {
+	files := []*FileInfo{
+		{Cid: "cid1", FileSize: 1, CreateAt: 10, Replicas: []Replica{{GroupOwner: "g1", Who: "a"}, {GroupOwner: "g2", Who: "b"}}},
+		{Cid: "cid2", FileSize: 2, CreateAt: 20, Replicas: []Replica{{GroupOwner: "g1", Who: "a"}}},
+	}
+	assert.NilError(t, store.UpdateReplicasBatch(files))
+	cnt, err := store.FileCnt()
+	assert.NilError(t, err)
+	assert.Equal(t, cnt, int64(2))
+
+	files = []*FileInfo{
+		{Cid: "cid1", FileSize: 1, ReportedReplicaCnt: 2, CreateAt: 99, Replicas: []Replica{{GroupOwner: "g1", Who: "a"}, {GroupOwner: "g3", Who: "c", IsReported: true}}},
+		{Cid: "cid2", FileSize: 2, ReportedReplicaCnt: 1, Replicas: []Replica{{GroupOwner: "g1", Who: "a", IsReported: true}}},
+	}
+	assert.NilError(t, store.UpdateReplicasBatch(files))
+	file, err := store.QueryFileByCid("cid1")
+	assert.NilError(t, err)
+	assert.Equal(t, file.ReportedReplicaCnt, uint32(2))
+	assert.Equal(t, file.CreateAt, uint32(10))
+
+	gs := store.(*gormStore)
+	for _, f := range files {
+		var replicas []Replica
+		err = gs.db.Table(gs.replicaTable(f.ID)).Where("file_id = ?", f.ID).Order("group_owner").Find(&replicas).Error
+		assert.NilError(t, err)
+		assert.Equal(t, len(replicas), len(f.Replicas))
+		for i := range replicas {
+			assert.Equal(t, replicas[i].Who, f.Replicas[i].Who)
+			assert.Equal(t, replicas[i].IsReported, f.Replicas[i].IsReported)
+		}
+	}
+}
+
+func TestSqliteUpdateReplicasBatch(t *testing.T) {
+	testUpdateReplicasBatch(t, getSqliteStore())
+}
+
+func TestReplicaTable(t *testing.T) {
+	assert.Equal(t, (&gormStore{}).replicaTable(7), "replica")
+	assert.Equal(t, (&gormStore{shards: 4}).replicaTable(7), "replica_3")
+	assert.Equal(t, (&gormStore{shards: 16}).replicaTable(7), "replica_07")
+	assert.Equal(t, (&gormStore{shards: 128}).replicaTable(1000), "replica_104")
+
+	_, err := NewStore(config.DbConfig{Type: TypeSqlite, Name: ":memory:", NumberShard: 2})
+	assert.ErrorContains(t, err, "not supported")
+}
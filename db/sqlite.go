@@ -0,0 +1,11 @@
+package db
+
+import (
+	"gorm.io/driver/sqlite"
+	"statistic/config"
+)
+
+// NewSqliteStore opens the sqlite database file DbConfig.Name, ":memory:" for an in-memory database
+func NewSqliteStore(config config.DbConfig) (Store, error) {
+	return openStore(sqlite.Open(config.Name), config)
+}
@@ -0,0 +1,238 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"statistic/config"
+	"strings"
+
+	"github.com/ChainSafe/log15"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+	"gorm.io/sharding"
+)
+
+// Store is the storage used by the chain indexer and the metrics
+type Store interface {
+	// schema migrations
+	MigrateUp(target int) error
+	MigrateDown(steps int) error
+	MigrationStatus() ([]MigrationState, error)
+
+	// Transaction runs fn with a store whose operations are committed or rolled back together
+	Transaction(fn func(tx Store) error) error
+	// Ping checks that the database is reachable
+	Ping() error
+
+	// check point
+	GetOrInit(start, end uint64) (uint64, error)
+	UpdateIndexKey(value, end uint64) error
+	GetBlockNumber() (uint64, error)
+	UpdateBlockNumber(blockNumber uint64) error
+	GetStorageKey(end uint64) (string, uint64, error)
+	UpdateStorageKey(key string, value uint64, end uint64) error
+	SegmentCheckPoints() (map[uint64]uint64, error)
+
+	// file and replica
+	SaveFiles(info *FileInfo, update bool) error
+	InsertFiles(info *FileInfo) error
+	UpdateFile(info *FileInfo) error
+	UpdateReplicas(info *FileInfo) error
+	UpdateReplicasBatch(infos []*FileInfo) error
+	QueryFileByCid(cid string) (*FileInfo, error)
+	DeleteReplicas(fileId int) error
+	DeleteByCid(cid string) error
+	CloseByCid(cid string, closedAt uint64, reason string) error
+	ClosedFilesByCid(cid string) ([]ClosedFile, error)
+	FileCnt() (int64, error)
+	AvgReplicas() (float64, error)
+	AvgReplicasBySize(low uint64, high uint64) (float64, error)
+	AvgReplicasByCreateTime(low uint64, high uint64) (float64, error)
+	FileCntByReplicaSize(low uint64, high uint64) (int64, error)
+	AvgFileSize() (float64, error)
+	AvgSpower() (float64, error)
+	FileCntBySlot(slot uint64) (int64, error)
+	FileCntBySize(low uint64, high uint64) (int64, error)
+	FileCntBySizeWithNoneRep(low uint64, high uint64) (int64, error)
+	FileCntByCreateTime(low uint64, high uint64) (int64, error)
+	FileCntByExpireTime(low uint64, high uint64) (int64, error)
+	ClosedFilesBySlot(slot uint64) (map[string]int64, error)
+	QueryFilesByCids(cids []string) ([]FileInfo, error)
+	ListFiles(filter FileFilter) ([]FileInfo, error)
+	ReplicasByFileIds(fileIds []int) (map[int][]Replica, error)
+
+	// storage provider
+	ProviderStats(by string, provider string) (*ProviderStat, error)
+	TopProviders(by string, limit int) ([]ProviderStat, error)
+	ReplicasByProvider(by string, provider string, limit int) ([]Replica, error)
+
+	// file stat rollups
+	ApplyFileStats(deltas []FileStat) error
+	RebuildFileStats() error
+	FileStatSums(kind string, fromSlot uint64, toSlot uint64) ([]FileStat, error)
+
+	// file history
+	SaveFileOrders(orders []FileOrder) error
+	ReplaceFileOrders(blockNumber uint64, orders []FileOrder) error
+	FileOrdersBySlot(slot uint64) (int64, error)
+	ReplaceFileRenewals(blockNumber uint64, renewals []FileRenewal) error
+	FileRenewalsByCid(cid string) ([]FileRenewal, error)
+	RenewalsBySlot(slot uint64) (int64, float64, error)
+	ReplaceReplicaEvents(blockNumber uint64, events []ReplicaEvent) error
+	ReplicaEventsByCid(cid string) ([]ReplicaEvent, error)
+	ReplicaEventsByAnchor(anchor string, cid string) ([]ReplicaEvent, error)
+	ReplicaChurnBySlot(slot uint64) (int64, int64, error)
+
+	// block time
+	SaveBlockTimes(times []BlockTime) error
+	BlockTimeAt(number uint64) (*BlockTime, error)
+	BlockAtTime(ts int64) (*BlockTime, error)
+
+	// history retention
+	RollupHistory(table string, before uint64) error
+	PruneHistory(table string, before uint64, limit int) (int64, error)
+	HistoryRollups(table string, fromSlot uint64, toSlot uint64) ([]HistoryRollup, error)
+
+	// error file
+	SaveError(errFile *ErrorFile) error
+	ListErrorFiles(afterId int, maxAttempts int, limit int) ([]ErrorFile, error)
+	MarkErrorAttempt(errFile *ErrorFile, cause error) error
+	DeleteErrorFile(id int) error
+	PurgeErrorFiles(minAttempts int) (int64, error)
+
+	// sworker snapshot, the readers below use the latest complete snapshot
+	CreateSnapshot(blockNumber uint64) (*SworkerSnapshot, error)
+	CompleteSnapshot(snapshot *SworkerSnapshot) error
+	LatestSnapshot() (int, error)
+	ListSnapshots(limit int) ([]SworkerSnapshot, error)
+	DeleteSnapshot(id int) error
+	PruneSnapshots(before int64) (int, error)
+
+	// work report, group and pub key
+	SaveWorkReports(snapshotId int, reports []*WorkReport) error
+	SumFree() (float64, error)
+	SumFileSize() (float64, error)
+	SumAllSpower() (float64, error)
+	NodeCntByRatio(low float64, high float64) (int64, error)
+	MemberCnt(anchors []string) (int64, error)
+	SaveGroups(snapshotId int, groups []*SworkerGroup) error
+	GroupCnt() (int64, error)
+	GroupActiveCnt() (int64, error)
+	AvgMembers() (float64, error)
+	AvgActiveMembers() (float64, error)
+	GroupCntByAll(low uint64, high uint64) (int64, error)
+	GroupCntByActive(low uint64, high uint64) (int64, error)
+	ActiveAnchors() ([]string, error)
+	SavePubKeys(snapshotId int, keys []*PubKey) error
+	GetVersionCnt() ([]VersionCnt, error)
+	GetGroupInfo(snapshotId int, anchors []string) (GroupInfo, error)
+	GetTopGroups() ([]SworkerGroup, error)
+	SaveGroupMembers(snapshotId int, members []*GroupMember) error
+	QuerySworker(anchor string) (*SworkerNode, error)
+	ListSworkers(filter SworkerFilter) ([]SworkerNode, error)
+	ListGroups(filter GroupFilter) ([]SworkerGroup, error)
+	QueryGroup(gid string) (*SworkerGroup, error)
+	GroupMembers(gids []string) (map[string][]GroupMember, error)
+}
+
+const (
+	TypeMysql    = "mysql"
+	TypePostgres = "postgres"
+	TypeSqlite   = "sqlite"
+)
+
+type gormStore struct {
+	db     *gorm.DB
+	shards int // number of replica shards, 0 if replica is not sharded
+}
+
+// with returns the store running on tx
+func (s *gormStore) with(tx *gorm.DB) *gormStore {
+	return &gormStore{db: tx, shards: s.shards}
+}
+
+// NewStore opens the store of DbConfig.Type and applies the pending migrations
+func NewStore(cfg config.DbConfig) (Store, error) {
+	s, err := OpenStore(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.MigrateUp(0); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// OpenStore opens the store of DbConfig.Type, mysql if it is empty
+func OpenStore(cfg config.DbConfig) (Store, error) {
+	switch strings.ToLower(cfg.Type) {
+	case "", TypeMysql:
+		return NewMysqlStore(cfg)
+	case TypePostgres:
+		return NewPostgresStore(cfg)
+	case TypeSqlite:
+		return NewSqliteStore(cfg)
+	default:
+		return nil, fmt.Errorf("unsupported db type %s", cfg.Type)
+	}
+}
+
+func openStore(dialector gorm.Dialector, cfg config.DbConfig) (Store, error) {
+	gormConfig := &gorm.Config{
+		NamingStrategy: schema.NamingStrategy{
+			SingularTable: true,
+		},
+		TranslateError: true,
+	}
+	db, err := gorm.Open(dialector, gormConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	if dialector.Name() == TypeSqlite {
+		// sqlite allows a single writer, share one connection to avoid database is locked errors
+		sqlDb, err := db.DB()
+		if err != nil {
+			return nil, err
+		}
+		sqlDb.SetMaxOpenConns(1)
+	}
+
+	if cfg.NumberShard > 0 {
+		// index names of the shard tables are the same, only mysql scopes index names by table
+		if dialector.Name() != TypeMysql {
+			return nil, fmt.Errorf("replica sharding is not supported on %s", dialector.Name())
+		}
+		middleware := sharding.Register(sharding.Config{
+			ShardingKey:         "file_id",
+			NumberOfShards:      uint(cfg.NumberShard),
+			PrimaryKeyGenerator: sharding.PKSnowflake,
+		}, "replica")
+		err = db.Use(middleware)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	s := &gormStore{db: db, shards: cfg.NumberShard}
+	log15.Info("complete init db", "type", dialector.Name())
+	return s, nil
+}
+
+func (s *gormStore) Transaction(fn func(tx Store) error) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		return fn(s.with(tx))
+	})
+}
+
+func (s *gormStore) Ping() error {
+	sqlDb, err := s.db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDb.Ping()
+}
+
+func isDuplicate(err error) bool {
+	return errors.Is(err, gorm.ErrDuplicatedKey)
+}
@@ -0,0 +1,77 @@
+package db
+
+import (
+	"statistic/config"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func getSqliteStore() Store {
+	store, err := NewStore(config.DbConfig{Type: TypeSqlite, Name: ":memory:"})
+	if err != nil {
+		panic(err)
+	}
+	return store
+}
+
+func TestSqliteStore(t *testing.T) {
+	store := getSqliteStore()
+
+	bn, err := store.GetBlockNumber()
+	assert.NilError(t, err)
+	assert.Equal(t, bn, uint64(0))
+	assert.NilError(t, store.UpdateBlockNumber(100))
+	bn, err = store.GetBlockNumber()
+	assert.NilError(t, err)
+	assert.Equal(t, bn, uint64(100))
+
+	index, err := store.GetOrInit(10, 20)
+	assert.NilError(t, err)
+	assert.Equal(t, index, uint64(10))
+	assert.NilError(t, store.UpdateIndexKey(15, 20))
+	index, err = store.GetOrInit(10, 20)
+	assert.NilError(t, err)
+	assert.Equal(t, index, uint64(15))
+
+	key, loaded, err := store.GetStorageKey(20)
+	assert.NilError(t, err)
+	assert.Equal(t, key, "")
+	assert.Equal(t, loaded, uint64(0))
+	assert.NilError(t, store.UpdateStorageKey("0x5ebf01", 200, 20))
+	key, loaded, err = store.GetStorageKey(20)
+	assert.NilError(t, err)
+	assert.Equal(t, key, "0x5ebf01")
+	assert.Equal(t, loaded, uint64(200))
+
+	file := &FileInfo{
+		Cid:                "QmPwJvYX1xdh4PAxhtf6s8X9iqVXDHUFsisaB27BTVvorH",
+		FileSize:           1024,
+		ReportedReplicaCnt: 1,
+		CreateAt:           50,
+		Replicas:           []Replica{{Who: "a", IsReported: true}},
+	}
+	assert.NilError(t, store.SaveFiles(file, false))
+	// duplicated insert is ignored
+	assert.NilError(t, store.InsertFiles(&FileInfo{Cid: file.Cid}))
+	cnt, err := store.FileCnt()
+	assert.NilError(t, err)
+	assert.Equal(t, cnt, int64(1))
+
+	file.ReportedReplicaCnt = 2
+	file.Replicas = []Replica{{Who: "a", IsReported: true}, {Who: "b", IsReported: true}}
+	assert.NilError(t, store.UpdateReplicas(file))
+	saved, err := store.QueryFileByCid(file.Cid)
+	assert.NilError(t, err)
+	assert.Equal(t, saved.ReportedReplicaCnt, uint32(2))
+	assert.Equal(t, saved.CreateAt, uint32(50))
+
+	assert.NilError(t, store.CloseByCid(file.Cid, 120, CloseReasonIllegal))
+	cnt, err = store.FileCnt()
+	assert.NilError(t, err)
+	assert.Equal(t, cnt, int64(0))
+	closed, err := store.ClosedFilesBySlot(600)
+	assert.NilError(t, err)
+	assert.Equal(t, closed[CloseReasonIllegal], int64(1))
+	assert.Equal(t, closed[CloseReasonClosed], int64(0))
+}
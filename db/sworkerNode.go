@@ -0,0 +1,173 @@
+package db
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// GroupMember maps a group member to its anchor, the group of a sworker node is looked up through it
+type GroupMember struct {
+	ID         int    `gorm:"primarykey" json:"id"`
+	SnapshotId int    `gorm:"index:idx_group_member_snapshot"`
+	GId        string `gorm:"index:idx_group_member_gid;type:VARCHAR(64)"`
+	Member     string `gorm:"type:VARCHAR(64)"`
+	Anchor     string `gorm:"index:idx_group_member_anchor;type:VARCHAR(130)"`
+}
+
+func (s *gormStore) SaveGroupMembers(snapshotId int, members []*GroupMember) error {
+	if len(members) == 0 {
+		return nil
+	}
+	for _, m := range members {
+		m.SnapshotId = snapshotId
+	}
+	return s.db.CreateInBatches(members, 100).Error
+}
+
+// SworkerNode is a work report with the code of its pub key and its group
+type SworkerNode struct {
+	WorkReport
+	Code string
+	GId  string
+}
+
+// SworkerFilter selects sworker nodes ordered by id, bounds are inclusive and nil bounds are open
+type SworkerFilter struct {
+	After        int // id of the last node of the previous page
+	Limit        int
+	MinRatio     *float64
+	MaxRatio     *float64
+	MinSlot      *uint64
+	MaxSlot      *uint64
+	Codes        []string // pub key codes to include
+	ExcludeCodes []string // pub key codes to exclude, nodes without a code are kept
+	GId          string
+}
+
+func (s *gormStore) sworkerNodes() (*gorm.DB, error) {
+	id, err := s.LatestSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	// an anchor may have several pub keys, the latest saved one is joined so that every node is listed once
+	latestKey := s.db.Table("pub_key").Select("max(id) as id, anchor").Where("snapshot_id = ?", id).Group("anchor")
+	return s.db.Table("work_report w").
+		Select("w.*, coalesce(pk.code, '') as code, coalesce(gm.g_id, '') as g_id").
+		Joins("left join (?) pm on pm.anchor = w.anchor", latestKey).
+		Joins("left join pub_key pk on pk.id = pm.id").
+		Joins("left join group_member gm on gm.anchor = w.anchor and gm.snapshot_id = w.snapshot_id").
+		Where("w.snapshot_id = ?", id), nil
+}
+
+// QuerySworker returns the node of anchor in the latest snapshot
+func (s *gormStore) QuerySworker(anchor string) (*SworkerNode, error) {
+	tx, err := s.sworkerNodes()
+	if err != nil {
+		return nil, err
+	}
+	var res []SworkerNode
+	err = tx.Where("w.anchor = ?", anchor).Order("w.id").Limit(1).Scan(&res).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(res) == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &res[0], nil
+}
+
+func (s *gormStore) ListSworkers(filter SworkerFilter) ([]SworkerNode, error) {
+	tx, err := s.sworkerNodes()
+	if err != nil {
+		return nil, err
+	}
+	tx.Where("w.id > ?", filter.After)
+	if filter.MinRatio != nil {
+		tx.Where("w.ratio >= ?", *filter.MinRatio)
+	}
+	if filter.MaxRatio != nil {
+		tx.Where("w.ratio <= ?", *filter.MaxRatio)
+	}
+	if filter.MinSlot != nil {
+		tx.Where("w.slot >= ?", *filter.MinSlot)
+	}
+	if filter.MaxSlot != nil {
+		tx.Where("w.slot <= ?", *filter.MaxSlot)
+	}
+	if len(filter.Codes) > 0 {
+		tx.Where("pk.code in ?", filter.Codes)
+	}
+	if len(filter.ExcludeCodes) > 0 {
+		tx.Where("(pk.code is null or pk.code not in ?)", filter.ExcludeCodes)
+	}
+	if filter.GId != "" {
+		tx.Where("gm.g_id = ?", filter.GId)
+	}
+	var res []SworkerNode
+	err = tx.Order("w.id").Limit(filter.Limit).Scan(&res).Error
+	return res, err
+}
+
+// GroupSortColumns are the sworker_group columns groups can be sorted by
+var GroupSortColumns = map[string]bool{
+	"spower":     true,
+	"file_size":  true,
+	"free":       true,
+	"all_member": true,
+	"active":     true,
+}
+
+// GroupFilter pages the groups of the latest snapshot sorted by Sort, ties are broken by id
+type GroupFilter struct {
+	Sort   string
+	Asc    bool
+	Offset int
+	Limit  int
+}
+
+func (s *gormStore) ListGroups(filter GroupFilter) ([]SworkerGroup, error) {
+	if !GroupSortColumns[filter.Sort] {
+		return nil, fmt.Errorf("invalid group sort column %q", filter.Sort)
+	}
+	tx, err := s.snapshotTable("sworker_group")
+	if err != nil {
+		return nil, err
+	}
+	order := " desc"
+	if filter.Asc {
+		order = " asc"
+	}
+	var res []SworkerGroup
+	err = tx.Order(filter.Sort + order).Order("id").
+		Offset(filter.Offset).Limit(filter.Limit).Find(&res).Error
+	return res, err
+}
+
+func (s *gormStore) QueryGroup(gid string) (*SworkerGroup, error) {
+	tx, err := s.snapshotTable("sworker_group")
+	if err != nil {
+		return nil, err
+	}
+	group := &SworkerGroup{}
+	err = tx.Where("g_id = ?", gid).First(group).Error
+	return group, err
+}
+
+// GroupMembers returns the members of the groups in the latest snapshot keyed by group id
+func (s *gormStore) GroupMembers(gids []string) (map[string][]GroupMember, error) {
+	res := make(map[string][]GroupMember, len(gids))
+	if len(gids) == 0 {
+		return res, nil
+	}
+	tx, err := s.snapshotTable("group_member")
+	if err != nil {
+		return nil, err
+	}
+	var members []GroupMember
+	err = tx.Where("g_id in ?", gids).Order("id").Find(&members).Error
+	for _, m := range members {
+		res[m.GId] = append(res[m.GId], m)
+	}
+	return res, err
+}
@@ -0,0 +1,86 @@
+package db
+
+import (
+	"testing"
+
+	"gorm.io/gorm"
+	"gotest.tools/assert"
+)
+
+func TestSqliteSworkers(t *testing.T) {
+	store := getSqliteStore()
+	snapshot, err := store.CreateSnapshot(100)
+	assert.NilError(t, err)
+	assert.NilError(t, store.SaveWorkReports(snapshot.ID, []*WorkReport{
+		{Anchor: "0xa1", Slot: 600, Ratio: 0.5},
+		{Anchor: "0xa2", Slot: 1200, Ratio: 0.9},
+		{Anchor: "0xa3", Slot: 1200, Ratio: 0.1},
+	}))
+	assert.NilError(t, store.SavePubKeys(snapshot.ID, []*PubKey{{Code: "0xc0", Anchor: "0xa1"}, {Code: "0xc1", Anchor: "0xa1"}, {Code: "0xc2", Anchor: "0xa2"}}))
+	assert.NilError(t, store.SaveGroupMembers(snapshot.ID, []*GroupMember{{GId: "g1", Member: "m1", Anchor: "0xa1"}}))
+	assert.NilError(t, store.CompleteSnapshot(snapshot))
+
+	node, err := store.QuerySworker("0xa1")
+	assert.NilError(t, err)
+	assert.Equal(t, node.Code, "0xc1")
+	assert.Equal(t, node.GId, "g1")
+	assert.Equal(t, node.Slot, uint64(600))
+	_, err = store.QuerySworker("0xff")
+	assert.Equal(t, err, gorm.ErrRecordNotFound)
+
+	minSlot := uint64(1200)
+	nodes, err := store.ListSworkers(SworkerFilter{Limit: 10, MinSlot: &minSlot, ExcludeCodes: []string{"0xc2"}})
+	assert.NilError(t, err)
+	assert.Equal(t, len(nodes), 1)
+	assert.Equal(t, nodes[0].Anchor, "0xa3")
+
+	minRatio := 0.4
+	nodes, err = store.ListSworkers(SworkerFilter{Limit: 1, MinRatio: &minRatio})
+	assert.NilError(t, err)
+	assert.Equal(t, len(nodes), 1)
+	nodes, err = store.ListSworkers(SworkerFilter{After: nodes[0].ID, Limit: 10, MinRatio: &minRatio})
+	assert.NilError(t, err)
+	assert.Equal(t, len(nodes), 1)
+	assert.Equal(t, nodes[0].Anchor, "0xa2")
+
+	// the node with two pub keys is listed once
+	nodes, err = store.ListSworkers(SworkerFilter{Limit: 10})
+	assert.NilError(t, err)
+	assert.Equal(t, len(nodes), 3)
+	nodes, err = store.ListSworkers(SworkerFilter{Limit: 10, Codes: []string{"0xc0"}})
+	assert.NilError(t, err)
+	assert.Equal(t, len(nodes), 0)
+}
+
+func TestSqliteGroups(t *testing.T) {
+	store := getSqliteStore()
+	snapshot, err := store.CreateSnapshot(100)
+	assert.NilError(t, err)
+	assert.NilError(t, store.SaveGroups(snapshot.ID, []*SworkerGroup{
+		{GId: "g1", AllMember: 2, Active: 2, Spower: 10},
+		{GId: "g2", AllMember: 1, Active: 1, Spower: 30},
+		{GId: "g3", AllMember: 3, Active: 0, Spower: 20},
+	}))
+	assert.NilError(t, store.SaveGroupMembers(snapshot.ID, []*GroupMember{
+		{GId: "g1", Member: "m1", Anchor: "0xa1"},
+		{GId: "g1", Member: "m2", Anchor: "0xa2"},
+		{GId: "g2", Member: "m3", Anchor: "0xa3"},
+	}))
+	assert.NilError(t, store.CompleteSnapshot(snapshot))
+
+	groups, err := store.ListGroups(GroupFilter{Sort: "spower", Offset: 1, Limit: 2})
+	assert.NilError(t, err)
+	assert.Equal(t, len(groups), 2)
+	assert.Equal(t, groups[0].GId, "g3")
+	assert.Equal(t, groups[1].GId, "g1")
+	_, err = store.ListGroups(GroupFilter{Sort: "g_id; drop table file_info", Limit: 2})
+	assert.Assert(t, err != nil)
+
+	group, err := store.QueryGroup("g2")
+	assert.NilError(t, err)
+	assert.Equal(t, group.Spower, int64(30))
+	members, err := store.GroupMembers([]string{"g1", "g3"})
+	assert.NilError(t, err)
+	assert.Equal(t, len(members["g1"]), 2)
+	assert.Equal(t, len(members["g3"]), 0)
+}
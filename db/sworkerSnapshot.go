@@ -0,0 +1,85 @@
+package db
+
+import "gorm.io/gorm"
+
+// SworkerSnapshot is one scan of work reports, groups and pub keys. Readers only see the latest complete snapshot.
+type SworkerSnapshot struct {
+	ID          int `gorm:"primarykey"`
+	BlockNumber uint64
+	AllCnt      int
+	ActiveCnt   int
+	Complete    bool  `gorm:"index:idx_snapshot_complete"`
+	CreatedAt   int64 `gorm:"index:idx_snapshot_created"`
+}
+
+func (s *gormStore) CreateSnapshot(blockNumber uint64) (*SworkerSnapshot, error) {
+	snapshot := &SworkerSnapshot{BlockNumber: blockNumber}
+	err := s.db.Create(snapshot).Error
+	return snapshot, err
+}
+
+// CompleteSnapshot marks the snapshot complete, readers switch to it at once
+func (s *gormStore) CompleteSnapshot(snapshot *SworkerSnapshot) error {
+	snapshot.Complete = true
+	return s.db.Model(snapshot).Select("all_cnt", "active_cnt", "complete").Updates(snapshot).Error
+}
+
+// LatestSnapshot returns the id of the latest complete snapshot, 0 if there is none
+func (s *gormStore) LatestSnapshot() (int, error) {
+	var id int
+	err := s.db.Model(&SworkerSnapshot{}).Select("coalesce(max(id), 0)").
+		Where("complete = ?", true).Scan(&id).Error
+	return id, err
+}
+
+func (s *gormStore) ListSnapshots(limit int) ([]SworkerSnapshot, error) {
+	var res []SworkerSnapshot
+	err := s.db.Where("complete = ?", true).Order("id desc").Limit(limit).Find(&res).Error
+	return res, err
+}
+
+// DeleteSnapshot deletes a snapshot with its rows, used when a scan fails
+func (s *gormStore) DeleteSnapshot(id int) error {
+	return s.deleteSnapshots([]int{id})
+}
+
+// PruneSnapshots deletes the snapshots created before the unix time, the latest complete snapshot is always kept
+func (s *gormStore) PruneSnapshots(before int64) (int, error) {
+	latest, err := s.LatestSnapshot()
+	if err != nil {
+		return 0, err
+	}
+	var ids []int
+	err = s.db.Model(&SworkerSnapshot{}).Where("created_at < ?", before).
+		Where("id <> ?", latest).Pluck("id", &ids).Error
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+	cnt := len(ids)
+	if latest > 0 {
+		// rows saved before snapshots were introduced
+		ids = append(ids, 0)
+	}
+	return cnt, s.deleteSnapshots(ids)
+}
+
+func (s *gormStore) deleteSnapshots(ids []int) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		for _, table := range []interface{}{&WorkReport{}, &SworkerGroup{}, &PubKey{}, &GroupMember{}} {
+			err := tx.Where("snapshot_id in ?", ids).Delete(table).Error
+			if err != nil {
+				return err
+			}
+		}
+		return tx.Where("id in ?", ids).Delete(&SworkerSnapshot{}).Error
+	})
+}
+
+// snapshotTable scopes table to the latest complete snapshot
+func (s *gormStore) snapshotTable(table string) (*gorm.DB, error) {
+	id, err := s.LatestSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	return s.db.Table(table).Where("snapshot_id = ?", id), nil
+}
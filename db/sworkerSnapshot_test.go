@@ -0,0 +1,43 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+)
+
+func TestSqliteSnapshots(t *testing.T) {
+	store := getSqliteStore()
+	first, err := store.CreateSnapshot(100)
+	assert.NilError(t, err)
+	assert.NilError(t, store.SaveWorkReports(first.ID, []*WorkReport{{Anchor: "0x01", Free: 10}, {Anchor: "0x02", Free: 20}}))
+	assert.NilError(t, store.CompleteSnapshot(first))
+
+	second, err := store.CreateSnapshot(200)
+	assert.NilError(t, err)
+	assert.NilError(t, store.SaveWorkReports(second.ID, []*WorkReport{{Anchor: "0x01", Free: 5}}))
+	// readers keep using the first snapshot until the second one is complete
+	free, err := store.SumFree()
+	assert.NilError(t, err)
+	assert.Equal(t, free, float64(30))
+
+	assert.NilError(t, store.CompleteSnapshot(second))
+	free, err = store.SumFree()
+	assert.NilError(t, err)
+	assert.Equal(t, free, float64(5))
+	cnt, err := store.MemberCnt([]string{"0x01", "0x02"})
+	assert.NilError(t, err)
+	assert.Equal(t, cnt, int64(1))
+
+	pruned, err := store.PruneSnapshots(time.Now().Unix() + 1)
+	assert.NilError(t, err)
+	assert.Equal(t, pruned, 1)
+	snapshots, err := store.ListSnapshots(10)
+	assert.NilError(t, err)
+	assert.Equal(t, len(snapshots), 1)
+	assert.Equal(t, snapshots[0].ID, second.ID)
+	free, err = store.SumFree()
+	assert.NilError(t, err)
+	assert.Equal(t, free, float64(5))
+}
@@ -3,8 +3,7 @@ package db
 import "testing"
 
 func TestListAnchor(t *testing.T) {
-	InitMysql(getConfig())
-	res, err := GetVersionCnt()
+	res, err := getStore().GetVersionCnt()
 	if err != nil {
 		panic(err)
 	}
@@ -14,8 +13,7 @@ func TestListAnchor(t *testing.T) {
 }
 
 func ExampleTopGroups() {
-	InitMysql(getConfig())
-	res, err := GetTopGroups()
+	res, err := getStore().GetTopGroups()
 	if err != nil {
 		panic(err)
 	}
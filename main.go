@@ -33,6 +33,7 @@ func init() {
 	app.Version = Version
 	app.EnableBashCompletion = true
 	app.Flags = append(app.Flags, cliFlag...)
+	app.Commands = commands
 
 }
 
@@ -74,16 +75,19 @@ func run(ctx *cli.Context) error {
 
 	log.Debug("Config on initialization...", "config", *cfg)
 
-	db.InitMysql(cfg.Db)
+	store, err := db.NewStore(cfg.Db)
+	if err != nil {
+		return err
+	}
 
 	logger := log.Root().New()
 
-	chain, err := chain.NewChain(cfg.Chain, logger)
+	chain, err := chain.NewChain(cfg.Chain, store, logger)
 	if err != nil {
 		return err
 	}
 
-	m := metrics.NewChainMetrics(cfg, chain.FetchCompleteCh())
+	m := metrics.NewChainMetrics(cfg, store, chain)
 	m.Start()
 	chain.Start()
 
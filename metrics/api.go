@@ -0,0 +1,140 @@
+package metrics
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	log "github.com/ChainSafe/log15"
+	"gorm.io/gorm"
+)
+
+const (
+	DefaultPageLimit = 100
+	MaxPageLimit     = 1000
+)
+
+type apiError struct {
+	Error string `json:"error"`
+}
+
+// apiHandler serves a read-only json endpoint, only GET is allowed
+func apiHandler(handler func(r *http.Request) (interface{}, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			writeJSON(w, http.StatusMethodNotAllowed, apiError{"method not allowed"})
+			return
+		}
+		resp, err := handler(r)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, resp)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		log.Error("Write api response failed", "err", err)
+	}
+}
+
+// badRequest marks errors caused by the request parameters
+type badRequest struct {
+	msg string
+}
+
+func (e *badRequest) Error() string {
+	return e.msg
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	var bad *badRequest
+	switch {
+	case errors.As(err, &bad):
+		writeJSON(w, http.StatusBadRequest, apiError{err.Error()})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		writeJSON(w, http.StatusNotFound, apiError{"not found"})
+	default:
+		log.Error("Api request failed", "err", err)
+		writeJSON(w, http.StatusInternalServerError, apiError{"internal error"})
+	}
+}
+
+// pathParam returns the path element after prefix, e.g. the cid of /api/files/{cid}
+func pathParam(r *http.Request, prefix string) (string, error) {
+	param := strings.TrimPrefix(r.URL.Path, prefix)
+	if param == "" || strings.Contains(param, "/") {
+		return "", gorm.ErrRecordNotFound
+	}
+	return param, nil
+}
+
+func queryUint64(r *http.Request, key string) (*uint64, error) {
+	v := r.URL.Query().Get(key)
+	if v == "" {
+		return nil, nil
+	}
+	n, err := strconv.ParseUint(v, 10, 64)
+	if err != nil {
+		return nil, &badRequest{fmt.Sprintf("invalid %s: %s", key, v)}
+	}
+	return &n, nil
+}
+
+func queryUint32(r *http.Request, key string) (*uint32, error) {
+	n, err := queryUint64(r, key)
+	if err != nil || n == nil {
+		return nil, err
+	}
+	if *n > 1<<32-1 {
+		return nil, &badRequest{fmt.Sprintf("invalid %s: %d", key, *n)}
+	}
+	v := uint32(*n)
+	return &v, nil
+}
+
+func queryFloat(r *http.Request, key string) (*float64, error) {
+	v := r.URL.Query().Get(key)
+	if v == "" {
+		return nil, nil
+	}
+	n, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return nil, &badRequest{fmt.Sprintf("invalid %s: %s", key, v)}
+	}
+	return &n, nil
+}
+
+// queryLimit returns the page size, DefaultPageLimit if it is not set
+func queryLimit(r *http.Request) (int, error) {
+	n, err := queryUint64(r, "limit")
+	if err != nil {
+		return 0, err
+	}
+	if n == nil {
+		return DefaultPageLimit, nil
+	}
+	if *n == 0 || *n > MaxPageLimit {
+		return 0, &badRequest{fmt.Sprintf("limit must be between 1 and %d", MaxPageLimit)}
+	}
+	return int(*n), nil
+}
+
+func registerApi() {
+	http.Handle("/api/files", apiHandler(listFiles))
+	http.Handle("/api/files/", apiHandler(getFile))
+	http.Handle("/api/sworkers", apiHandler(listSworkers))
+	http.Handle("/api/sworkers/", apiHandler(getSworker))
+	http.Handle("/api/groups", apiHandler(listGroups))
+	http.Handle("/api/groups/", apiHandler(getGroup))
+	http.HandleFunc("/api/stream", streamChanges)
+}
@@ -0,0 +1,129 @@
+package metrics
+
+import (
+	"net/http"
+	"statistic/db"
+)
+
+type replicaResp struct {
+	Who        string `json:"who"`
+	GroupOwner string `json:"group_owner"`
+	Anchor     string `json:"anchor"`
+	ValidAt    uint32 `json:"valid_at"`
+	IsReported bool   `json:"is_reported"`
+	CreateAt   uint32 `json:"create_at"`
+}
+
+type fileResp struct {
+	ID                 int           `json:"id"`
+	Cid                string        `json:"cid"`
+	FileSize           uint64        `json:"file_size"`
+	Spower             uint64        `json:"spower"`
+	ExpiredAt          uint32        `json:"expired_at"`
+	CreateAt           uint32        `json:"create_at"`
+	CalculatedAt       uint32        `json:"calculated_at"`
+	Amount             string        `json:"amount"`
+	Prepaid            string        `json:"prepaid"`
+	ReportedReplicaCnt uint32        `json:"reported_replica_cnt"`
+	RemainingPaidCnt   uint32        `json:"remaining_paid_cnt"`
+	Replicas           []replicaResp `json:"replicas,omitempty"`
+}
+
+type fileListResp struct {
+	Files []fileResp `json:"files"`
+	Next  int        `json:"next,omitempty"` // cursor of the next page, absent on the last page
+}
+
+func newFileResp(f *db.FileInfo, replicas []db.Replica) fileResp {
+	resp := fileResp{
+		ID:                 f.ID,
+		Cid:                f.Cid,
+		FileSize:           f.FileSize,
+		Spower:             f.Spower,
+		ExpiredAt:          f.ExpiredAt,
+		CreateAt:           f.CreateAt,
+		CalculatedAt:       f.CalculatedAt,
+		Amount:             f.Amount,
+		Prepaid:            f.Prepaid,
+		ReportedReplicaCnt: f.ReportedReplicaCnt,
+		RemainingPaidCnt:   f.RemainingPaidCnt,
+	}
+	for _, r := range replicas {
+		resp.Replicas = append(resp.Replicas, replicaResp{r.Who, r.GroupOwner, r.Anchor, r.ValidAt, r.IsReported, r.CreateAt})
+	}
+	return resp
+}
+
+// getFile serves GET /api/files/{cid}
+func getFile(r *http.Request) (interface{}, error) {
+	cid, err := pathParam(r, "/api/files/")
+	if err != nil {
+		return nil, err
+	}
+	store := chainMetric.store
+	file, err := store.QueryFileByCid(cid)
+	if err != nil {
+		return nil, err
+	}
+	replicas, err := store.ReplicasByFileIds([]int{file.ID})
+	if err != nil {
+		return nil, err
+	}
+	return newFileResp(file, replicas[file.ID]), nil
+}
+
+// listFiles serves GET /api/files, the files are ordered by id and cursor is the id of the last file of the previous page
+func listFiles(r *http.Request) (interface{}, error) {
+	filter, err := fileFilter(r)
+	if err != nil {
+		return nil, err
+	}
+	files, err := chainMetric.store.ListFiles(filter)
+	if err != nil {
+		return nil, err
+	}
+	resp := fileListResp{Files: make([]fileResp, 0, len(files))}
+	for i := range files {
+		resp.Files = append(resp.Files, newFileResp(&files[i], nil))
+	}
+	if len(files) == filter.Limit {
+		resp.Next = files[len(files)-1].ID
+	}
+	return resp, nil
+}
+
+func fileFilter(r *http.Request) (filter db.FileFilter, err error) {
+	cursor, err := queryUint64(r, "cursor")
+	if err != nil {
+		return
+	}
+	if cursor != nil {
+		filter.After = int(*cursor)
+	}
+	if filter.Limit, err = queryLimit(r); err != nil {
+		return
+	}
+	if filter.MinSize, err = queryUint64(r, "min_size"); err != nil {
+		return
+	}
+	if filter.MaxSize, err = queryUint64(r, "max_size"); err != nil {
+		return
+	}
+	if filter.MinReplicas, err = queryUint32(r, "min_replicas"); err != nil {
+		return
+	}
+	if filter.MaxReplicas, err = queryUint32(r, "max_replicas"); err != nil {
+		return
+	}
+	if filter.CreateFrom, err = queryUint32(r, "create_from"); err != nil {
+		return
+	}
+	if filter.CreateTo, err = queryUint32(r, "create_to"); err != nil {
+		return
+	}
+	if filter.ExpireFrom, err = queryUint32(r, "expire_from"); err != nil {
+		return
+	}
+	filter.ExpireTo, err = queryUint32(r, "expire_to")
+	return
+}
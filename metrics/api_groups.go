@@ -0,0 +1,164 @@
+package metrics
+
+import (
+	"net/http"
+	"statistic/chain"
+	"statistic/db"
+	"sync"
+)
+
+// stakeLimitCache keeps the stake limits of the last handlerTopStake run, the api reads them from here
+// instead of listing Staking.StakeLimit on every request
+type stakeLimitCache struct {
+	mu     sync.RWMutex
+	limits map[string]float64
+}
+
+var stakeLimits = &stakeLimitCache{}
+
+func (c *stakeLimitCache) set(stakes []chain.StakeLimit) {
+	limits := make(map[string]float64, len(stakes))
+	for _, stake := range stakes {
+		limits[stake.Acc] = stake.Value
+	}
+	c.mu.Lock()
+	c.limits = limits
+	c.mu.Unlock()
+}
+
+// get returns the cached stake limits, they are fetched from chain if handlerTopStake has not run yet
+func (c *stakeLimitCache) get() (map[string]float64, error) {
+	c.mu.RLock()
+	limits := c.limits
+	c.mu.RUnlock()
+	if limits != nil {
+		return limits, nil
+	}
+	stakes, err := chain.GetTopStakeLimit(chain.DefaultConn)
+	if err != nil {
+		return nil, err
+	}
+	c.set(stakes)
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.limits, nil
+}
+
+type groupMemberResp struct {
+	Member string `json:"member"`
+	Anchor string `json:"anchor"`
+}
+
+type groupResp struct {
+	GId        string            `json:"gid"`
+	AllMember  int               `json:"all_member"`
+	Active     int               `json:"active"`
+	Free       int64             `json:"free"`
+	FileSize   int64             `json:"file_size"`
+	Spower     int64             `json:"spower"`
+	StakeLimit float64           `json:"stake_limit"`
+	Members    []groupMemberResp `json:"members"`
+}
+
+type groupListResp struct {
+	Groups []groupResp `json:"groups"`
+	Offset int         `json:"offset"`
+	Limit  int         `json:"limit"`
+}
+
+func newGroupResp(g *db.SworkerGroup, members []db.GroupMember, limits map[string]float64) groupResp {
+	resp := groupResp{
+		GId:        g.GId,
+		AllMember:  g.AllMember,
+		Active:     g.Active,
+		Free:       g.Free,
+		FileSize:   g.FileSize,
+		Spower:     g.Spower,
+		StakeLimit: limits[g.GId],
+		Members:    make([]groupMemberResp, 0, len(members)),
+	}
+	for _, m := range members {
+		resp.Members = append(resp.Members, groupMemberResp{m.Member, m.Anchor})
+	}
+	return resp
+}
+
+// getGroup serves GET /api/groups/{gid}, the group owner is the validator account of the stake limit
+func getGroup(r *http.Request) (interface{}, error) {
+	gid, err := pathParam(r, "/api/groups/")
+	if err != nil {
+		return nil, err
+	}
+	store := chainMetric.store
+	group, err := store.QueryGroup(gid)
+	if err != nil {
+		return nil, err
+	}
+	members, err := store.GroupMembers([]string{gid})
+	if err != nil {
+		return nil, err
+	}
+	limits, err := stakeLimits.get()
+	if err != nil {
+		return nil, err
+	}
+	return newGroupResp(group, members[gid], limits), nil
+}
+
+// listGroups serves GET /api/groups sorted by sort (spower by default) and paged by offset and limit
+func listGroups(r *http.Request) (interface{}, error) {
+	filter, err := groupFilter(r)
+	if err != nil {
+		return nil, err
+	}
+	store := chainMetric.store
+	groups, err := store.ListGroups(filter)
+	if err != nil {
+		return nil, err
+	}
+	gids := make([]string, 0, len(groups))
+	for _, g := range groups {
+		gids = append(gids, g.GId)
+	}
+	members, err := store.GroupMembers(gids)
+	if err != nil {
+		return nil, err
+	}
+	limits, err := stakeLimits.get()
+	if err != nil {
+		return nil, err
+	}
+	resp := groupListResp{Groups: make([]groupResp, 0, len(groups)), Offset: filter.Offset, Limit: filter.Limit}
+	for i := range groups {
+		resp.Groups = append(resp.Groups, newGroupResp(&groups[i], members[groups[i].GId], limits))
+	}
+	return resp, nil
+}
+
+func groupFilter(r *http.Request) (filter db.GroupFilter, err error) {
+	query := r.URL.Query()
+	filter.Sort = query.Get("sort")
+	if filter.Sort == "" {
+		filter.Sort = "spower"
+	} else if !db.GroupSortColumns[filter.Sort] {
+		err = &badRequest{"invalid sort: " + filter.Sort}
+		return
+	}
+	switch query.Get("order") {
+	case "", "desc":
+	case "asc":
+		filter.Asc = true
+	default:
+		err = &badRequest{"invalid order: " + query.Get("order")}
+		return
+	}
+	offset, err := queryUint64(r, "offset")
+	if err != nil {
+		return
+	}
+	if offset != nil {
+		filter.Offset = int(*offset)
+	}
+	filter.Limit, err = queryLimit(r)
+	return
+}
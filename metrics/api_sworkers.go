@@ -0,0 +1,132 @@
+package metrics
+
+import (
+	"net/http"
+	"statistic/db"
+)
+
+type sworkerResp struct {
+	ID       int     `json:"id"`
+	Anchor   string  `json:"anchor"`
+	Slot     uint64  `json:"slot"`
+	Spower   uint64  `json:"spower"`
+	Free     uint64  `json:"free"`
+	FileSize uint64  `json:"file_size"`
+	Ratio    float64 `json:"ratio"`
+	SrdRoot  string  `json:"srd_root"`
+	FileRoot string  `json:"file_root"`
+	Code     string  `json:"code"`
+	Version  string  `json:"version"`
+	Group    string  `json:"group,omitempty"`
+}
+
+type sworkerListResp struct {
+	Sworkers []sworkerResp `json:"sworkers"`
+	Next     int           `json:"next,omitempty"` // cursor of the next page, absent on the last page
+}
+
+// codeVersion resolves the sworker version of a pub key code
+func codeVersion(code string) string {
+	if version, ok := versionMap[code]; ok {
+		return version
+	}
+	return versionMap["0x"]
+}
+
+// versionCodes returns the codes of version, the unknown version is every code that is not in versionMap
+func versionCodes(version string) (codes []string, exclude []string) {
+	unknown := versionMap["0x"]
+	for code, v := range versionMap {
+		if version == unknown {
+			if v != unknown {
+				exclude = append(exclude, code)
+			}
+		} else if v == version {
+			codes = append(codes, code)
+		}
+	}
+	return
+}
+
+func newSworkerResp(n *db.SworkerNode) sworkerResp {
+	return sworkerResp{
+		ID:       n.ID,
+		Anchor:   n.Anchor,
+		Slot:     n.Slot,
+		Spower:   n.Spower,
+		Free:     n.Free,
+		FileSize: n.FileSize,
+		Ratio:    n.Ratio,
+		SrdRoot:  n.SrdRoot,
+		FileRoot: n.FileRoot,
+		Code:     n.Code,
+		Version:  codeVersion(n.Code),
+		Group:    n.GId,
+	}
+}
+
+// getSworker serves GET /api/sworkers/{anchor} from the latest sworker snapshot
+func getSworker(r *http.Request) (interface{}, error) {
+	anchor, err := pathParam(r, "/api/sworkers/")
+	if err != nil {
+		return nil, err
+	}
+	node, err := chainMetric.store.QuerySworker(anchor)
+	if err != nil {
+		return nil, err
+	}
+	return newSworkerResp(node), nil
+}
+
+// listSworkers serves GET /api/sworkers, min_slot and max_slot select nodes by the slot of their last work report
+func listSworkers(r *http.Request) (interface{}, error) {
+	filter, err := sworkerFilter(r)
+	if err != nil {
+		return nil, err
+	}
+	nodes, err := chainMetric.store.ListSworkers(filter)
+	if err != nil {
+		return nil, err
+	}
+	resp := sworkerListResp{Sworkers: make([]sworkerResp, 0, len(nodes))}
+	for i := range nodes {
+		resp.Sworkers = append(resp.Sworkers, newSworkerResp(&nodes[i]))
+	}
+	if len(nodes) == filter.Limit {
+		resp.Next = nodes[len(nodes)-1].ID
+	}
+	return resp, nil
+}
+
+func sworkerFilter(r *http.Request) (filter db.SworkerFilter, err error) {
+	cursor, err := queryUint64(r, "cursor")
+	if err != nil {
+		return
+	}
+	if cursor != nil {
+		filter.After = int(*cursor)
+	}
+	if filter.Limit, err = queryLimit(r); err != nil {
+		return
+	}
+	if filter.MinRatio, err = queryFloat(r, "min_ratio"); err != nil {
+		return
+	}
+	if filter.MaxRatio, err = queryFloat(r, "max_ratio"); err != nil {
+		return
+	}
+	if filter.MinSlot, err = queryUint64(r, "min_slot"); err != nil {
+		return
+	}
+	if filter.MaxSlot, err = queryUint64(r, "max_slot"); err != nil {
+		return
+	}
+	filter.GId = r.URL.Query().Get("group")
+	if version := r.URL.Query().Get("version"); version != "" {
+		filter.Codes, filter.ExcludeCodes = versionCodes(version)
+		if len(filter.Codes) == 0 && len(filter.ExcludeCodes) == 0 {
+			err = &badRequest{"unknown version: " + version}
+		}
+	}
+	return
+}
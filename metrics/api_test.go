@@ -0,0 +1,153 @@
+package metrics
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"statistic/chain"
+	"statistic/config"
+	"statistic/db"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func newTestMetrics(t *testing.T) db.Store {
+	store, err := db.NewStore(config.DbConfig{Type: db.TypeSqlite, Name: ":memory:"})
+	assert.NilError(t, err)
+	chainMetric = &ChainMetrics{store: store, stop: make(chan int)}
+	return store
+}
+
+// getJSON serves a GET of url and decodes the response into v unless v is nil
+func getJSON(t *testing.T, handler http.Handler, url string, status int, v interface{}) {
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+	assert.Equal(t, rec.Code, status, rec.Body.String())
+	assert.Equal(t, rec.Header().Get("Content-Type"), "application/json")
+	if v != nil {
+		assert.NilError(t, json.Unmarshal(rec.Body.Bytes(), v))
+	}
+}
+
+func TestApiFiles(t *testing.T) {
+	store := newTestMetrics(t)
+	for i, size := range []uint64{10, 100, 1000} {
+		f := &db.FileInfo{Cid: fmt.Sprintf("Qm%d", i), FileSize: size, ReportedReplicaCnt: uint32(i), ExpiredAt: 5000}
+		if i == 0 {
+			f.Replicas = []db.Replica{{Who: "a", GroupOwner: "g1", Anchor: "0x01", IsReported: true}}
+		}
+		assert.NilError(t, store.SaveFiles(f, false))
+	}
+	list := apiHandler(listFiles)
+	get := apiHandler(getFile)
+
+	var page fileListResp
+	getJSON(t, list, "/api/files?limit=2", http.StatusOK, &page)
+	assert.Equal(t, len(page.Files), 2)
+	assert.Equal(t, page.Next, page.Files[1].ID)
+	next := page.Next
+	page = fileListResp{}
+	getJSON(t, list, fmt.Sprintf("/api/files?limit=2&cursor=%d", next), http.StatusOK, &page)
+	assert.Equal(t, len(page.Files), 1)
+	assert.Equal(t, page.Files[0].Cid, "Qm2")
+	assert.Equal(t, page.Next, 0)
+
+	page = fileListResp{}
+	getJSON(t, list, "/api/files?min_size=50&max_replicas=1", http.StatusOK, &page)
+	assert.Equal(t, len(page.Files), 1)
+	assert.Equal(t, page.Files[0].Cid, "Qm1")
+
+	var file fileResp
+	getJSON(t, get, "/api/files/Qm0", http.StatusOK, &file)
+	assert.Equal(t, file.FileSize, uint64(10))
+	assert.DeepEqual(t, file.Replicas, []replicaResp{{"a", "g1", "0x01", 0, true, 0}})
+
+	getJSON(t, get, "/api/files/QmX", http.StatusNotFound, nil)
+	getJSON(t, get, "/api/files/", http.StatusNotFound, nil)
+	getJSON(t, get, "/api/files/Qm0/replicas", http.StatusNotFound, nil)
+	getJSON(t, list, "/api/files?limit=0", http.StatusBadRequest, nil)
+	getJSON(t, list, fmt.Sprintf("/api/files?limit=%d", MaxPageLimit+1), http.StatusBadRequest, nil)
+	getJSON(t, list, "/api/files?min_size=abc", http.StatusBadRequest, nil)
+	getJSON(t, list, "/api/files?create_to=4294967296", http.StatusBadRequest, nil)
+
+	rec := httptest.NewRecorder()
+	list.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/files", nil))
+	assert.Equal(t, rec.Code, http.StatusMethodNotAllowed)
+	assert.Equal(t, rec.Header().Get("Allow"), http.MethodGet)
+}
+
+func TestApiSworkers(t *testing.T) {
+	store := newTestMetrics(t)
+	snapshot, err := store.CreateSnapshot(100)
+	assert.NilError(t, err)
+	assert.NilError(t, store.SaveWorkReports(snapshot.ID, []*db.WorkReport{
+		{Anchor: "0xa1", Slot: 600, Ratio: 0.5},
+		{Anchor: "0xa2", Slot: 1200, Ratio: 0.9},
+		{Anchor: "0xa3", Slot: 1200, Ratio: 0.1},
+	}))
+	v2 := "0x69f72f97fc90b6686e53b64cd0b5325c8c8c8d7eed4ecdaa3827b4ff791694c0"
+	assert.NilError(t, store.SavePubKeys(snapshot.ID, []*db.PubKey{{Code: v2, Anchor: "0xa1"}}))
+	assert.NilError(t, store.SaveGroupMembers(snapshot.ID, []*db.GroupMember{{GId: "g1", Member: "m1", Anchor: "0xa1"}}))
+	assert.NilError(t, store.CompleteSnapshot(snapshot))
+	list := apiHandler(listSworkers)
+	get := apiHandler(getSworker)
+
+	var node sworkerResp
+	getJSON(t, get, "/api/sworkers/0xa1", http.StatusOK, &node)
+	assert.Equal(t, node.Version, "v2.0.0")
+	assert.Equal(t, node.Group, "g1")
+	getJSON(t, get, "/api/sworkers/0xff", http.StatusNotFound, nil)
+
+	var page sworkerListResp
+	getJSON(t, list, "/api/sworkers?version=v2.0.0", http.StatusOK, &page)
+	assert.Equal(t, len(page.Sworkers), 1)
+	assert.Equal(t, page.Sworkers[0].Anchor, "0xa1")
+	page = sworkerListResp{}
+	getJSON(t, list, "/api/sworkers?version=unknown&min_slot=1200&limit=1", http.StatusOK, &page)
+	assert.Equal(t, len(page.Sworkers), 1)
+	assert.Equal(t, page.Sworkers[0].Anchor, "0xa2")
+	next := page.Next
+	page = sworkerListResp{}
+	getJSON(t, list, fmt.Sprintf("/api/sworkers?version=unknown&min_slot=1200&limit=1&cursor=%d", next), http.StatusOK, &page)
+	assert.Equal(t, len(page.Sworkers), 1)
+	assert.Equal(t, page.Sworkers[0].Anchor, "0xa3")
+
+	getJSON(t, list, "/api/sworkers?version=v9.9.9", http.StatusBadRequest, nil)
+	getJSON(t, list, "/api/sworkers?max_ratio=high", http.StatusBadRequest, nil)
+	getJSON(t, list, "/api/sworkers?cursor=-1", http.StatusBadRequest, nil)
+}
+
+func TestApiGroups(t *testing.T) {
+	store := newTestMetrics(t)
+	snapshot, err := store.CreateSnapshot(100)
+	assert.NilError(t, err)
+	assert.NilError(t, store.SaveGroups(snapshot.ID, []*db.SworkerGroup{
+		{GId: "g1", AllMember: 1, Active: 1, Spower: 100},
+		{GId: "g2", AllMember: 2, Active: 2, Spower: 300},
+	}))
+	assert.NilError(t, store.SaveGroupMembers(snapshot.ID, []*db.GroupMember{{GId: "g1", Member: "m1", Anchor: "0xa1"}}))
+	assert.NilError(t, store.CompleteSnapshot(snapshot))
+	// the stake limits are read from chain until handlerTopStake has run
+	stakeLimits.set([]chain.StakeLimit{{Acc: "g1", Value: 10}})
+	list := apiHandler(listGroups)
+	get := apiHandler(getGroup)
+
+	var group groupResp
+	getJSON(t, get, "/api/groups/g1", http.StatusOK, &group)
+	assert.Equal(t, group.StakeLimit, float64(10))
+	assert.DeepEqual(t, group.Members, []groupMemberResp{{"m1", "0xa1"}})
+	getJSON(t, get, "/api/groups/g3", http.StatusNotFound, nil)
+
+	var page groupListResp
+	getJSON(t, list, "/api/groups?sort=spower&order=asc&offset=1", http.StatusOK, &page)
+	assert.Equal(t, len(page.Groups), 1)
+	assert.Equal(t, page.Groups[0].GId, "g2")
+	assert.Equal(t, page.Offset, 1)
+	assert.Equal(t, len(page.Groups[0].Members), 0)
+
+	getJSON(t, list, "/api/groups?sort=g_id", http.StatusBadRequest, nil)
+	getJSON(t, list, "/api/groups?order=up", http.StatusBadRequest, nil)
+	getJSON(t, list, "/api/groups?offset=x", http.StatusBadRequest, nil)
+}
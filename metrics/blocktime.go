@@ -0,0 +1,71 @@
+package metrics
+
+import "statistic/config"
+
+const (
+	// blockSeconds is the target block time, the bucket conditions are given in blocks of it
+	blockSeconds = 6
+	// maxBlockGap is the longest a block may follow a time for block_time to cover that time, in second
+	maxBlockGap = 60
+	// eraBlocks is the length of a staking era of 6 hours
+	eraBlocks = 3600
+)
+
+// blockClock turns the durations of the bucket conditions into block numbers with the block_time index,
+// it falls back to blocks of blockSeconds where the index has no data
+type blockClock struct {
+	now   uint64
+	nowTs int64   // timestamp of block now, 0 if unknown
+	rate  float64 // seconds per block over the last day
+}
+
+func newBlockClock(now uint64) blockClock {
+	c := blockClock{now: now, rate: blockSeconds}
+	bt, err := chainMetric.store.BlockTimeAt(now)
+	if err != nil {
+		return c
+	}
+	c.nowTs = bt.Timestamp + int64(now-bt.BlockNumber)*blockSeconds
+	if bt.BlockNumber <= config.DayBlocks {
+		return c
+	}
+	old, err := chainMetric.store.BlockTimeAt(bt.BlockNumber - config.DayBlocks)
+	if err == nil && old.BlockNumber < bt.BlockNumber && old.Timestamp < bt.Timestamp {
+		c.rate = float64(bt.Timestamp-old.Timestamp) / float64(bt.BlockNumber-old.BlockNumber)
+	}
+	return c
+}
+
+// before returns the block produced blocks*blockSeconds ago
+func (c blockClock) before(blocks uint64) uint64 {
+	if c.nowTs > 0 {
+		ts := c.nowTs - int64(blocks)*blockSeconds
+		bt, err := chainMetric.store.BlockAtTime(ts)
+		if err == nil && bt.Timestamp-ts <= maxBlockGap {
+			return bt.BlockNumber
+		}
+	}
+	if blocks >= c.now {
+		return 0
+	}
+	return c.now - blocks
+}
+
+// after returns the block expected blocks*blockSeconds from now at the recent block rate
+func (c blockClock) after(blocks uint64) uint64 {
+	return c.now + uint64(float64(blocks)*blockSeconds/c.rate)
+}
+
+// eraTime returns the timestamp of the block the given number of eras before now from the block_time index,
+// it falls back to eras of 6 hours before ts, the timestamp of now, where the index has no data
+func (c blockClock) eraTime(ts int64, eras uint32) int64 {
+	blocks := uint64(eras) * eraBlocks
+	if blocks < c.now {
+		number := c.now - blocks
+		bt, err := chainMetric.store.BlockTimeAt(number)
+		if err == nil && (number-bt.BlockNumber)*blockSeconds <= maxBlockGap {
+			return bt.Timestamp + int64(number-bt.BlockNumber)*blockSeconds
+		}
+	}
+	return ts - int64(blocks)*blockSeconds
+}
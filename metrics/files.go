@@ -25,6 +25,11 @@ type fileMetrics struct {
 	fileCntByCreateTime      *prometheus.GaugeVec
 	fileCntByExpireTime      *prometheus.GaugeVec
 	fileOrdersBySlot         *prometheus.GaugeVec
+	replicaChurnBySlot       *prometheus.GaugeVec
+	renewalsBySlot           *prometheus.GaugeVec
+	closedFilesBySlot        *prometheus.GaugeVec
+	topProviders             *prometheus.GaugeVec
+	prunedRows               *prometheus.CounterVec
 }
 
 func NewFileMetrics(cfg config.MetricConfig) fileMetrics {
@@ -116,6 +121,41 @@ func NewFileMetrics(cfg config.MetricConfig) fileMetrics {
 			},
 			[]string{"slot"},
 		),
+		replicaChurnBySlot: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: prefix + "ReplicaChurnBySlot",
+				Help: "Number of replicas added and deleted by work reports by slot",
+			},
+			[]string{"slot", "type"},
+		),
+		renewalsBySlot: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: prefix + "RenewalsBySlot",
+				Help: "Number of file renewals and renewed file size(PB) by slot",
+			},
+			[]string{"slot", "type"},
+		),
+		closedFilesBySlot: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: prefix + "ClosedFilesBySlot",
+				Help: "Number of closed files by slot and reason",
+			},
+			[]string{"slot", "reason"},
+		),
+		topProviders: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: prefix + "TopProviders",
+				Help: "Files, stored size(TB) and reported and unreported replicas of the top storage providers",
+			},
+			[]string{"by", "provider", "type"},
+		),
+		prunedRows: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: prefix + "PrunedRows",
+				Help: "Number of history rows deleted by the retention policies",
+			},
+			[]string{"table"},
+		),
 	}
 }
 
@@ -134,6 +174,11 @@ func (f *fileMetrics) getFileCollector() []prometheus.Collector {
 		f.fileCntByCreateTime,
 		f.fileCntByExpireTime,
 		f.fileOrdersBySlot,
+		f.replicaChurnBySlot,
+		f.renewalsBySlot,
+		f.closedFilesBySlot,
+		f.topProviders,
+		f.prunedRows,
 	}
 }
 
@@ -1,16 +1,19 @@
 package metrics
 
 import (
+	"errors"
 	"math"
 	"statistic/chain"
 	"statistic/config"
 	"statistic/db"
 	"strconv"
+	"time"
 
 	log "github.com/ChainSafe/log15"
 )
 
-type metricHandler func()
+// metricHandler is a scheduled handler, its last successful run is reported by /healthz
+type metricHandler func() error
 
 const (
 	PB             = 1 << 50
@@ -20,8 +23,11 @@ const (
 
 var Handlers []struct {
 	interval int
+	name     string
 	handler  metricHandler
 }
+var errLatestHeight = errors.New("latest block height unavailable")
+
 var (
 	sworkerActive = false
 	slot          uint64
@@ -35,27 +41,29 @@ func initHandler(config config.MetricConfig) {
 	stakeInterval := config.StakeInterval
 	Handlers = []struct {
 		interval int
+		name     string
 		handler  metricHandler
 	}{
-		{interval, handlerAverageRepilicas},
-		{interval, handlerFileAndSpower},
-		{interval, handlerReplicaCntBySize},
-		{interval, handlerReplicaCntByCreateTime},
-		{interval, handlerFileCntByReplicas},
-		{interval / 6, handlerSlotFileCnt},
-		{interval, handlerFileCntBySize},
-		{interval, handlerFileCntByCreateTime},
-		{interval, handlerFileCntByExpireTime},
-		{interval, handlerSwoker},
-		{stakeInterval, handlerStake},
-		{stakeInterval, handlerTopStake},
-		{stakeInterval, handlerStakeCount},
-		{stakeInterval, handlerRewards},
+		{interval, "average_replicas", handlerAverageRepilicas},
+		{interval, "file_and_spower", handlerFileAndSpower},
+		{interval, "replica_cnt_by_size", handlerReplicaCntBySize},
+		{interval, "replica_cnt_by_create_time", handlerReplicaCntByCreateTime},
+		{interval, "file_cnt_by_replicas", handlerFileCntByReplicas},
+		{interval / 6, "slot_file_cnt", handlerSlotFileCnt},
+		{interval, "file_cnt_by_size", handlerFileCntBySize},
+		{interval, "file_cnt_by_create_time", handlerFileCntByCreateTime},
+		{interval, "file_cnt_by_expire_time", handlerFileCntByExpireTime},
+		{interval, "sworker", handlerSwoker},
+		{config.TopProvidersInterval, "top_providers", handlerTopProviders},
+		{stakeInterval, "stake", handlerStake},
+		{stakeInterval, "top_stake", handlerTopStake},
+		{stakeInterval, "stake_count", handlerStakeCount},
+		{stakeInterval, "rewards", handlerRewards},
 	}
 }
 
 func initSlot(start uint64) {
-	index, err := db.GetBlockNumber()
+	index, err := chainMetric.store.GetBlockNumber()
 	if err != nil {
 		index = 0
 	}
@@ -66,54 +74,47 @@ func initSlot(start uint64) {
 }
 
 func getSlot(i uint64) uint64 {
-	return i / chain.SlotSize * chain.SlotSize
+	return i / config.SlotBlocks * config.SlotBlocks
 }
 
 // 全网平均副本数
-func handlerAverageRepilicas() {
-	avg, err := db.AvgReplicas()
+func handlerAverageRepilicas() error {
+	stats, err := chainMetric.store.FileStatSums(db.StatSize, 0, 0)
 	if err != nil {
 		log.Error("get avg replicas error", "err", err)
-		return
+		return err
 	}
-	chainMetric.avgReplicas.Set(avg)
+	chainMetric.avgReplicas.Set(avgReplicas(sumStats(stats, allBuckets)))
+	return nil
 }
 
 // 全网文件数量、文件file_size和spower平均值
-func handlerFileAndSpower() {
-	count, err := db.FileCnt()
+func handlerFileAndSpower() error {
+	stats, err := chainMetric.store.FileStatSums(db.StatSize, 0, 0)
 	if err != nil {
-		log.Error("get file count error", "err", err)
-		return
+		log.Error("get file stats error", "err", err)
+		return err
 	}
-	chainMetric.filesCnt.Set(float64(count))
-	avgFileSize, err := db.AvgFileSize()
-	if err != nil {
-		log.Error("get avg file size error", "err", err)
-		return
+	sum := sumStats(stats, allBuckets)
+	chainMetric.filesCnt.Set(float64(sum.Files))
+	chainMetric.sumFileSpower.WithLabelValues("file_size").Set(float64(sum.Bytes) / float64(PB))
+	chainMetric.sumFileSpower.WithLabelValues("spower").Set(float64(sum.Spower) / float64(PB))
+	if sum.Bytes > 0 {
+		chainMetric.fileRatio.Set(float64(sum.Spower) / float64(sum.Bytes))
 	}
-	avgSpower, err := db.AvgSpower()
-	if err != nil {
-		log.Error("get avg spower size error", "err", err)
-		return
-	}
-	sumFileSize := avgFileSize * float64(count) / float64(PB)
-	sumSpower := avgSpower * float64(count) / float64(PB)
-	chainMetric.sumFileSpower.WithLabelValues("file_size").Set(sumFileSize)
-	chainMetric.sumFileSpower.WithLabelValues("spower").Set(sumSpower)
-	chainMetric.fileRatio.Set(avgSpower / avgFileSize)
 	log.Info("handler File And Spower done")
+	return nil
 }
 
 // 按文件大小统计平均副本数
-func handlerReplicaCntBySize() {
+func handlerReplicaCntBySize() error {
+	stats, err := chainMetric.store.FileStatSums(db.StatSize, 0, 0)
+	if err != nil {
+		log.Error("get file stats by size error", "err", err)
+		return err
+	}
 	for _, c := range avgReplicasBySize {
-		avg, err := db.AvgReplicasBySize(uint64(c.low), uint64(c.high))
-		if err != nil {
-			log.Error("get avg replicas by size error", "label", c.name, "err", err)
-			c.value = 0
-			continue
-		}
+		avg := avgReplicas(sumStats(stats, sizeBuckets(c)))
 		log.Debug("avg replicas by size", "label", c.name, "value", avg)
 		c.value = avg
 	}
@@ -121,26 +122,30 @@ func handlerReplicaCntBySize() {
 		chainMetric.avgReplicasBySize.WithLabelValues(c.name).Set(c.value)
 	}
 	log.Info("handlerReplicaCntBySize done")
+	return nil
 }
 
 // 按创建时间统计平均副本数
-func handlerReplicaCntByCreateTime() {
+func handlerReplicaCntByCreateTime() error {
 	now := chain.DefaultConn.GetLatestHeight()
 	if now == 0 {
-		return
+		return errLatestHeight
 	}
+	clock := newBlockClock(now)
 	for _, c := range avgReplicasByCreateTime {
-		low := now - uint64(c.high)
-		if c.high == math.MaxUint64 {
-			low = 0
+		low := uint64(0)
+		if c.high != math.MaxUint64 {
+			low = clock.before(uint64(c.high))
 		}
-		high := now - uint64(c.low)
-		avg, err := db.AvgReplicasByCreateTime(low, high)
+		high := clock.before(uint64(c.low))
+		from, to := slotRange(low, high)
+		stats, err := chainMetric.store.FileStatSums(db.StatSize, from, to)
 		if err != nil {
 			log.Error("get avg replicas by create time error", "label", c.name, "err", err)
 			c.value = 0
 			continue
 		}
+		avg := avgReplicas(sumStats(stats, allBuckets))
 		log.Debug("avg replicas by create time", "label", c.name, "value", avg)
 		c.value = avg
 	}
@@ -148,17 +153,18 @@ func handlerReplicaCntByCreateTime() {
 		chainMetric.avgReplicasByCreateTime.WithLabelValues(c.name).Set(c.value)
 	}
 	log.Info("handlerReplicaCntByCreateTime done")
+	return nil
 }
 
 // 按副本数量统计文件个数
-func handlerFileCntByReplicas() {
+func handlerFileCntByReplicas() error {
+	stats, err := chainMetric.store.FileStatSums(db.StatReplica, 0, 0)
+	if err != nil {
+		log.Error("get file stats by replicas error", "err", err)
+		return err
+	}
 	for _, c := range fileCntByReplicaSize {
-		cnt, err := db.FileCntByReplicaSize(uint64(c.low), uint64(c.high))
-		if err != nil {
-			log.Error("get file count by replicas size error", "label", c.name, "err", err)
-			c.value = 0
-			continue
-		}
+		cnt := sumStats(stats, replicaBuckets(c)).Files
 		log.Debug("file count by replica size", "label", c.name, "value", cnt)
 		c.value = float64(cnt)
 	}
@@ -166,44 +172,68 @@ func handlerFileCntByReplicas() {
 		chainMetric.filesCntByReplicas.WithLabelValues(c.name).Set(c.value)
 	}
 	log.Info("handlerFileCntByReplicas done")
+	return nil
 }
 
 // handlerSlotFileCnt 新增文件数
-func handlerSlotFileCnt() {
-	bn, err := db.GetBlockNumber()
+func handlerSlotFileCnt() error {
+	bn, err := chainMetric.store.GetBlockNumber()
 	if err != nil {
-		return
+		return err
 	}
 	if bn < slot {
-		return
+		return nil
 	}
-	label := strconv.Itoa(int(slot - chain.SlotSize))
-	cnt, err := db.FileCntBySlot(slot)
+	label := strconv.Itoa(int(slot - config.SlotBlocks))
+	stats, err := chainMetric.store.FileStatSums(db.StatSize, slot-config.SlotBlocks, slot)
 	if err != nil {
 		log.Error("get file count by slot error", "label", label, "err", err)
-		return
+		return err
 	}
-	chainMetric.fileCntBySlot.WithLabelValues(label).Set(float64(cnt))
-	orders, err := db.FileOrdersBySlot(slot)
+	chainMetric.fileCntBySlot.WithLabelValues(label).Set(float64(sumStats(stats, allBuckets).Files))
+	orders, err := chainMetric.store.FileOrdersBySlot(slot)
 	if err != nil {
 		log.Error("get file orders by slot error", "label", label, "err", err)
-		return
+		return err
 	}
 	chainMetric.fileOrdersBySlot.WithLabelValues(label).Set(float64(orders))
+	added, deleted, err := chainMetric.store.ReplicaChurnBySlot(slot)
+	if err != nil {
+		log.Error("get replica churn by slot error", "label", label, "err", err)
+		return err
+	}
+	chainMetric.replicaChurnBySlot.WithLabelValues(label, "add").Set(float64(added))
+	chainMetric.replicaChurnBySlot.WithLabelValues(label, "del").Set(float64(deleted))
+	renewals, volume, err := chainMetric.store.RenewalsBySlot(slot)
+	if err != nil {
+		log.Error("get renewals by slot error", "label", label, "err", err)
+		return err
+	}
+	chainMetric.renewalsBySlot.WithLabelValues(label, "count").Set(float64(renewals))
+	chainMetric.renewalsBySlot.WithLabelValues(label, "size").Set(volume / float64(PB))
+	closed, err := chainMetric.store.ClosedFilesBySlot(slot)
+	if err != nil {
+		log.Error("get closed files by slot error", "label", label, "err", err)
+		return err
+	}
+	for reason, cnt := range closed {
+		chainMetric.closedFilesBySlot.WithLabelValues(label, reason).Set(float64(cnt))
+	}
 
-	slot += chain.SlotSize
+	slot += config.SlotBlocks
 	log.Info("Handler Slot Files done")
+	return nil
 }
 
 // 按文件大小统计文件个数
-func handlerFileCntBySize() {
+func handlerFileCntBySize() error {
+	stats, err := chainMetric.store.FileStatSums(db.StatSize, 0, 0)
+	if err != nil {
+		log.Error("get file stats by size error", "err", err)
+		return err
+	}
 	for _, c := range fileCntBySize {
-		cnt, err := db.FileCntBySize(uint64(c.low), uint64(c.high))
-		if err != nil {
-			log.Error("get file count by size error", "label", c.name, "err", err)
-			c.value = 0
-			continue
-		}
+		cnt := sumStats(stats, sizeBuckets(c)).Files
 		log.Debug("file count by file size", "label", c.name, "value", cnt)
 		c.value = float64(cnt)
 	}
@@ -212,12 +242,7 @@ func handlerFileCntBySize() {
 	}
 
 	for _, c := range fileCntBySizeNoneRep {
-		cnt, err := db.FileCntBySizeWithNoneRep(uint64(c.low), uint64(c.high))
-		if err != nil {
-			log.Error("get file count by size with no-zero replicas error", "label", c.name, "err", err)
-			c.value = 0
-			continue
-		}
+		cnt := sumStats(stats, sizeBuckets(c)).Reported
 		log.Debug("file count by file size with no-zero replicas", "label", c.name, "value", cnt)
 		c.value = float64(cnt)
 	}
@@ -225,26 +250,30 @@ func handlerFileCntBySize() {
 		chainMetric.fileCntBySizeWithNoneRep.WithLabelValues(c.name).Set(c.value)
 	}
 	log.Info("handlerFileCntBySize done")
+	return nil
 }
 
 // 按创建时间统计文件个数
-func handlerFileCntByCreateTime() {
+func handlerFileCntByCreateTime() error {
 	now := chain.DefaultConn.GetLatestHeight()
 	if now == 0 {
-		return
+		return errLatestHeight
 	}
+	clock := newBlockClock(now)
 	for _, c := range fileCntByCreateTime {
-		low := now - uint64(c.high)
-		if c.high == math.MaxUint64 {
-			low = 0
+		low := uint64(0)
+		if c.high != math.MaxUint64 {
+			low = clock.before(uint64(c.high))
 		}
-		high := now - uint64(c.low)
-		cnt, err := db.FileCntByCreateTime(low, high)
+		high := clock.before(uint64(c.low))
+		from, to := slotRange(low, high)
+		stats, err := chainMetric.store.FileStatSums(db.StatSize, from, to)
 		if err != nil {
 			log.Error("get file count by create time error", "label", c.name, "err", err)
 			c.value = 0
 			continue
 		}
+		cnt := sumStats(stats, allBuckets).Files
 		log.Debug("file count by create time", "label", c.name, "value", cnt)
 		c.value = float64(cnt)
 	}
@@ -252,33 +281,35 @@ func handlerFileCntByCreateTime() {
 		chainMetric.fileCntByCreateTime.WithLabelValues(c.name).Set(c.value)
 	}
 	log.Info("handlerFileCntByCreateTime done")
+	return nil
 }
 
 // 按文件过期时间统计文件个数
-func handlerFileCntByExpireTime() {
+func handlerFileCntByExpireTime() error {
 	now := chain.DefaultConn.GetLatestHeight()
 	if now == 0 {
-		return
+		return errLatestHeight
 	}
+	stats, err := chainMetric.store.FileStatSums(db.StatExpire, 0, 0)
+	if err != nil {
+		log.Error("get file stats by expire time error", "err", err)
+		return err
+	}
+	clock := newBlockClock(now)
 	var low, high uint64
 	for _, c := range fileCntByExpireTime {
 		if c.high == c.low {
 			low = 0
 			high = now
 		} else {
-			low = uint64(c.low) + now
+			low = clock.after(uint64(c.low))
 			if c.high == math.MaxUint64 {
 				high = math.MaxUint64
 			} else {
-				high = uint64(c.high) + now
+				high = clock.after(uint64(c.high))
 			}
 		}
-		cnt, err := db.FileCntByExpireTime(low, high)
-		if err != nil {
-			log.Error("get file count by expire time error", "label", c.name, "err", err)
-			c.value = 0
-			continue
-		}
+		cnt := sumStats(stats, slotBuckets(low, high)).Files
 		log.Debug("file count by expire time", "label", c.name, "value", cnt)
 		c.value = float64(cnt)
 	}
@@ -286,36 +317,68 @@ func handlerFileCntByExpireTime() {
 		chainMetric.fileCntByExpireTime.WithLabelValues(c.name).Set(c.value)
 	}
 	log.Info("handlerFileCntByExpireTime done")
+	return nil
 }
 
-func handlerSwoker() {
+// 按存储账户、group和anchor统计存储量最大的节点
+func handlerTopProviders() error {
+	tops := make(map[string][]db.ProviderStat)
+	for _, by := range []string{db.ProviderWho, db.ProviderGroupOwner, db.ProviderAnchor} {
+		stats, err := chainMetric.store.TopProviders(by, chainMetric.config.TopProviders)
+		if err != nil {
+			log.Error("get top providers error", "by", by, "err", err)
+			return err
+		}
+		tops[by] = stats
+	}
+	// providers dropping out of the top are removed
+	chainMetric.topProviders.Reset()
+	for by, stats := range tops {
+		for _, st := range stats {
+			chainMetric.topProviders.WithLabelValues(by, st.Provider, "files").Set(float64(st.Files))
+			chainMetric.topProviders.WithLabelValues(by, st.Provider, "size").Set(float64(st.Bytes) / float64(TB))
+			chainMetric.topProviders.WithLabelValues(by, st.Provider, "reported").Set(float64(st.Reported))
+			chainMetric.topProviders.WithLabelValues(by, st.Provider, "unreported").Set(float64(st.Unreported))
+		}
+	}
+	log.Info("handlerTopProviders done")
+	return nil
+}
+
+// handlerSwoker scans the sworkers into a new snapshot, the metrics read it once it is complete
+func handlerSwoker() error {
 	if sworkerActive {
-		return
+		return nil
 	}
 	sworkerActive = true
-	err := db.ClearSworker()
-	if err != nil {
-		log.Error("clear tmp data  error", "err", err)
+	defer func() {
 		sworkerActive = false
-		return
+	}()
+	bn := chain.DefaultConn.GetLatestHeight()
+	snapshot, err := chainMetric.store.CreateSnapshot(bn)
+	if err != nil {
+		log.Error("create sworker snapshot error", "err", err)
+		return err
 	}
-	all, active, err := chain.GetAllSworkReports(chain.DefaultConn)
+	all, active, err := scanSworkers(snapshot.ID)
 	if err != nil {
-		log.Error("get swork report error", "err", err)
-		sworkerActive = false
-		return
+		log.Error("scan sworkers error", "snapshot", snapshot.ID, "err", err)
+		if e := chainMetric.store.DeleteSnapshot(snapshot.ID); e != nil {
+			log.Error("delete sworker snapshot error", "snapshot", snapshot.ID, "err", e)
+		}
+		return err
 	}
-	log.Info("get swork report done")
+	snapshot.AllCnt, snapshot.ActiveCnt = all, active
+	err = chainMetric.store.CompleteSnapshot(snapshot)
+	if err != nil {
+		log.Error("complete sworker snapshot error", "snapshot", snapshot.ID, "err", err)
+		return err
+	}
+	log.Info("sworker snapshot done", "snapshot", snapshot.ID, "block", bn)
 	go handlerStorage(all, active)
 	go handlerStorageV2(all, active)
 	go handlerSwokerByRatio()
 	go handlerSworkerVersion()
-	err = chain.GetGroupInfo(chain.DefaultConn)
-	if err != nil {
-		log.Error("get group info error", "err", err)
-		sworkerActive = false
-		return
-	}
 	go handlerGroupCnt()
 	go handlerGroupByMemberCnt()
 	go handlerGroupByActiveCnt()
@@ -323,16 +386,47 @@ func handlerSwoker() {
 		go handlerValidators()
 	}
 	sworkerCnt++
-	sworkerActive = false
+	pruneSnapshots()
+	return nil
+}
+
+// scanSworkers saves the work reports, groups and pub keys into the snapshot
+func scanSworkers(snapshotId int) (int, int, error) {
+	all, active, err := chain.GetAllSworkReports(chain.DefaultConn, chainMetric.store, snapshotId)
+	if err != nil {
+		return 0, 0, err
+	}
+	log.Info("get swork report done")
+	err = chain.GetGroupInfo(chain.DefaultConn, chainMetric.store, snapshotId)
+	if err != nil {
+		return 0, 0, err
+	}
+	err = chain.GetPubKeys(chain.DefaultConn, chainMetric.store, snapshotId)
+	if err != nil {
+		return 0, 0, err
+	}
+	return all, active, nil
+}
+
+func pruneSnapshots() {
+	before := time.Now().Unix() - int64(chainMetric.config.SnapshotRetention)
+	cnt, err := chainMetric.store.PruneSnapshots(before)
+	if err != nil {
+		log.Error("prune sworker snapshots error", "err", err)
+		return
+	}
+	if cnt > 0 {
+		log.Info("prune sworker snapshots done", "count", cnt)
+	}
 }
 
 func handlerStorage(all, active int) {
-	free, err := db.SumFree()
+	free, err := chainMetric.store.SumFree()
 	if err != nil {
 		log.Error("get storage free error", "err", err)
 		return
 	}
-	fileSize, err := db.SumFileSize()
+	fileSize, err := chainMetric.store.SumFileSize()
 	if err != nil {
 		log.Error("get storage file size error", "err", err)
 		return
@@ -348,17 +442,17 @@ func handlerStorage(all, active int) {
 }
 
 func handlerStorageV2(all, active int) {
-	free, err := db.SumFree()
+	free, err := chainMetric.store.SumFree()
 	if err != nil {
 		log.Error("get storage free error", "err", err)
 		return
 	}
-	fileSize, err := db.SumFileSize()
+	fileSize, err := chainMetric.store.SumFileSize()
 	if err != nil {
 		log.Error("get storage file size error", "err", err)
 		return
 	}
-	allSpower, err := db.SumAllSpower()
+	allSpower, err := chainMetric.store.SumAllSpower()
 	if err != nil {
 		log.Error("get all spower error", "err", err)
 		return
@@ -381,7 +475,7 @@ func handlerStorageV2(all, active int) {
 
 func handlerSwokerByRatio() {
 	for _, c := range swokerRatio {
-		cnt, err := db.NodeCntByRatio(c.low, c.high)
+		cnt, err := chainMetric.store.NodeCntByRatio(c.low, c.high)
 		if err != nil {
 			log.Error("get swoker count by ratio error", "label", c.name, "err", err)
 			c.value = 0
@@ -397,12 +491,12 @@ func handlerSwokerByRatio() {
 }
 
 func handlerGroupCnt() {
-	all, err := db.GroupCnt()
+	all, err := chainMetric.store.GroupCnt()
 	if err != nil {
 		log.Error("get group cnt error", "err", err)
 		return
 	}
-	active, err := db.GroupActiveCnt()
+	active, err := chainMetric.store.GroupActiveCnt()
 	if err != nil {
 		log.Error("get group active cnt error", "err", err)
 		return
@@ -410,12 +504,12 @@ func handlerGroupCnt() {
 	chainMetric.groupCnt.WithLabelValues("all").Set(float64(all))
 	chainMetric.groupCnt.WithLabelValues("active").Set(float64(active))
 
-	avgMember, err := db.AvgMembers()
+	avgMember, err := chainMetric.store.AvgMembers()
 	if err != nil {
 		log.Error("get avg member cnt error", "err", err)
 		return
 	}
-	avgActiveMember, err := db.AvgActiveMembers()
+	avgActiveMember, err := chainMetric.store.AvgActiveMembers()
 	if err != nil {
 		log.Error("get avg active member cnt error", "err", err)
 		return
@@ -426,7 +520,7 @@ func handlerGroupCnt() {
 
 func handlerGroupByMemberCnt() {
 	for _, c := range groupCntByMemberCnt {
-		cnt, err := db.GroupCntByAll(uint64(c.low), uint64(c.high))
+		cnt, err := chainMetric.store.GroupCntByAll(uint64(c.low), uint64(c.high))
 		if err != nil {
 			log.Error("get group cnt by member cnt error", "label", c.name, "err", err)
 			c.value = 0
@@ -443,7 +537,7 @@ func handlerGroupByMemberCnt() {
 
 func handlerGroupByActiveCnt() {
 	for _, c := range groupCntByActiveCnt {
-		cnt, err := db.GroupCntByActive(uint64(c.low), uint64(c.high))
+		cnt, err := chainMetric.store.GroupCntByActive(uint64(c.low), uint64(c.high))
 		if err != nil {
 			log.Error("get group cnt by active member cnt error", "label", c.name, "err", err)
 			c.value = 0
@@ -459,12 +553,7 @@ func handlerGroupByActiveCnt() {
 }
 
 func handlerSworkerVersion() {
-	err := chain.GetPubKeys(chain.DefaultConn)
-	if err != nil {
-		log.Error("get pub keys error", "err", err)
-		return
-	}
-	codes, err := db.GetVersionCnt()
+	codes, err := chainMetric.store.GetVersionCnt()
 	if err != nil {
 		log.Error("db version cnt error", "err", err)
 		return
@@ -485,65 +574,69 @@ func handlerSworkerVersion() {
 	log.Info("sworker version done")
 }
 
-func handlerStake() {
+func handlerStake() error {
 
 	ts, err := chain.DefaultConn.GetTimestamp()
 	if err != nil {
 		log.Error("get current timestamp error", "err", err)
-		return
+		return err
 	}
 	if !isInit {
 		index, err := chain.GetCurrentIndex(chain.DefaultConn)
 		if err != nil {
 			log.Error("get current era error", "err", err)
-			return
+			return err
 		}
 		stakes, err := chain.GetTotalStakes(chain.DefaultConn)
 		if err != nil {
 			log.Error("get total stakes error", "err", err)
-			return
+			return err
 		}
+		clock := newBlockClock(chain.DefaultConn.GetLatestHeight())
 		for _, stake := range stakes {
-			hisTs := int(ts) - int(index-stake.Index)*3600*6
-			chainMetric.totalStakes.WithLabelValues(strconv.Itoa(int(stake.Index)), strconv.Itoa(hisTs)).Set(float64(stake.Value))
+			hisTs := clock.eraTime(ts, index-stake.Index)
+			chainMetric.totalStakes.WithLabelValues(strconv.Itoa(int(stake.Index)), strconv.Itoa(int(hisTs))).Set(float64(stake.Value))
 		}
 		isInit = true
 	} else {
 		i, v, err := chain.GetStakeByIndex(chain.DefaultConn)
 		if err != nil {
 			log.Error("get stake by index error", "err", err)
-			return
+			return err
 		}
 		chainMetric.totalStakes.WithLabelValues(strconv.Itoa(int(i)), strconv.Itoa(int(ts))).Set(v)
 	}
 	log.Info("total stakes done")
+	return nil
 }
 
-func handlerTopStake() {
+func handlerTopStake() error {
 	ts, err := chain.DefaultConn.GetTimestamp()
 	if err != nil {
 		log.Error("get current timestamp error", "err", err)
-		return
+		return err
 	}
 	index, err := chain.GetCurrentIndex(chain.DefaultConn)
 	if err != nil {
 		log.Error("get current era error", "err", err)
-		return
+		return err
 	}
 	stakes, err := chain.GetTopStakeLimit(chain.DefaultConn)
 	if err != nil {
 		log.Error("get top stake limit error", "err", err)
-		return
+		return err
 	}
+	stakeLimits.set(stakes)
 	eraIndex := strconv.Itoa(int(index))
 	for _, stake := range stakes {
 		chainMetric.topStakeLimit.WithLabelValues(eraIndex, stake.Acc, strconv.Itoa(int(ts))).Set(stake.Value / float64(TB))
 	}
 	log.Info("top stake limit done")
+	return nil
 }
 
 func handlerValidators() {
-	validators, err := db.GetTopGroups()
+	validators, err := chainMetric.store.GetTopGroups()
 	if err != nil {
 		log.Error("get top groups error", "err", err)
 		return
@@ -558,16 +651,16 @@ func handlerValidators() {
 	log.Info("top validators done")
 }
 
-func handlerStakeCount() {
+func handlerStakeCount() error {
 	index, err := chain.GetCurrentIndex(chain.DefaultConn)
 	if err != nil {
 		log.Error("get current era error", "err", err)
-		return
+		return err
 	}
 	ts, err := chain.DefaultConn.GetTimestamp()
 	if err != nil {
 		log.Error("get current timestamp error", "err", err)
-		return
+		return err
 	}
 	chainMetric.currentEra.Set(float64(index))
 	eraIndex := strconv.Itoa(int(index))
@@ -585,46 +678,49 @@ func handlerStakeCount() {
 		chainMetric.validators.WithLabelValues(eraIndex, strconv.Itoa(int(ts))).Set(float64(vCnt))
 	}
 	log.Info("validators count done")
+	return nil
 }
 
-func handlerRewards() {
+func handlerRewards() error {
 	ts, err := chain.DefaultConn.GetTimestamp()
 	if err != nil {
 		log.Error("get current timestamp error", "err", err)
-		return
+		return err
 	}
 	if !isRewardInit {
 		index, err := chain.GetCurrentIndex(chain.DefaultConn)
 		if err != nil {
 			log.Error("get current era error", "err", err)
-			return
+			return err
 		}
 		values, err := chain.GetStakingPayout(chain.DefaultConn)
 		if err != nil {
 			log.Error("get staking payout error", "err", err)
-			return
+			return err
 		}
 		payouts, err := chain.GetAuthoringPayout(chain.DefaultConn)
 		if err != nil {
 			log.Error("get author payout error", "err", err)
-			return
+			return err
 		}
+		clock := newBlockClock(chain.DefaultConn.GetLatestHeight())
 		for _, value := range values {
 			if v, ok := payouts[value.Index]; ok {
 				value.Value += v
 			}
-			hisTs := int(ts) - int(index-value.Index)*3600*6
-			chainMetric.rewards.WithLabelValues(strconv.Itoa(int(value.Index)), strconv.Itoa(hisTs)).Set(value.Value)
+			hisTs := clock.eraTime(ts, index-value.Index)
+			chainMetric.rewards.WithLabelValues(strconv.Itoa(int(value.Index)), strconv.Itoa(int(hisTs))).Set(value.Value)
 		}
 		isRewardInit = true
 	} else {
 		i, v, err := chain.GetRewardByIndex(chain.DefaultConn)
 		if err != nil {
 			log.Error("get reward by index error", "err", err)
-			return
+			return err
 		}
-		ts = ts - 3600*6
+		ts = newBlockClock(chain.DefaultConn.GetLatestHeight()).eraTime(ts, 1)
 		chainMetric.rewards.WithLabelValues(strconv.Itoa(int(i)), strconv.Itoa(int(ts))).Set(v)
 	}
 	log.Info("era rewards done")
+	return nil
 }
@@ -0,0 +1,88 @@
+package metrics
+
+import (
+	"net/http"
+	"statistic/chain"
+	"sync"
+	"time"
+)
+
+// handlerRun is the last run of a scheduled handler
+type handlerRun struct {
+	LastRun     time.Time  `json:"last_run"`
+	LastSuccess *time.Time `json:"last_success,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+}
+
+type handlerTracker struct {
+	mu   sync.RWMutex
+	runs map[string]handlerRun
+}
+
+var handlerRuns = &handlerTracker{runs: make(map[string]handlerRun)}
+
+// track wraps handler for the scheduler and records the result of every run under name
+func (t *handlerTracker) track(name string, handler metricHandler) func() {
+	return func() {
+		err := handler()
+		now := time.Now()
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		run := t.runs[name]
+		run.LastRun = now
+		if err != nil {
+			run.LastError = err.Error()
+		} else {
+			run.LastSuccess = &now
+			run.LastError = ""
+		}
+		t.runs[name] = run
+	}
+}
+
+func (t *handlerTracker) snapshot() map[string]handlerRun {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	res := make(map[string]handlerRun, len(t.runs))
+	for name, run := range t.runs {
+		res[name] = run
+	}
+	return res
+}
+
+type healthResp struct {
+	Status   string                `json:"status"`
+	Ingest   *chain.Status         `json:"ingest"`
+	Handlers map[string]handlerRun `json:"handlers"`
+}
+
+func health() (int, healthResp) {
+	st := chainMetric.chain.Status()
+	if err := chainMetric.store.Ping(); err != nil {
+		st.DbErr = err.Error()
+	}
+	resp := healthResp{"ok", st, handlerRuns.snapshot()}
+	if st.DbErr != "" || st.RpcErr != "" {
+		resp.Status = "unavailable"
+		return http.StatusServiceUnavailable, resp
+	}
+	if st.Fetching {
+		resp.Status = "fetching"
+	}
+	return http.StatusOK, resp
+}
+
+// healthz reports the ingest progress and the scheduled handlers, it fails when the database or the node is unreachable
+func healthz(w http.ResponseWriter, r *http.Request) {
+	status, resp := health()
+	writeJSON(w, status, resp)
+}
+
+// readyz fails in addition while the initial fetch is running
+func readyz(w http.ResponseWriter, r *http.Request) {
+	status, resp := health()
+	if resp.Ingest.Fetching {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, resp)
+}
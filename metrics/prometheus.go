@@ -8,7 +8,9 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"net/http"
+	"statistic/chain"
 	"statistic/config"
+	"statistic/db"
 	"time"
 )
 
@@ -18,24 +20,32 @@ type ChainMetrics struct {
 	fileMetrics
 	sworkerMetrics
 	stakeMetrics
+	store     db.Store
+	chain     *chain.Chain
+	feed      *chain.ChangeFeed
 	startCh   <-chan int
 	stop      chan int
 	config    config.MetricConfig
+	retention config.RetentionConfig
 	scheduler *gocron.Scheduler
 }
 
 var chainMetric *ChainMetrics
 
-func NewChainMetrics(config *config.Config, startCh <-chan int) *ChainMetrics {
+func NewChainMetrics(config *config.Config, store db.Store, c *chain.Chain) *ChainMetrics {
 
 	chainMetric = &ChainMetrics{
 		fileMetrics:    NewFileMetrics(config.Metric),
 		sworkerMetrics: NewSworkerMetrics(config.Metric),
 		stakeMetrics:   NewStakeMetrics(config.Metric),
-		startCh:        startCh,
+		store:          store,
+		chain:          c,
+		feed:           c.Feed(),
+		startCh:        c.FetchCompleteCh(),
 		stop:           make(chan int),
 		config:         config.Metric,
-		scheduler:      registerSecheduler(config.Metric),
+		retention:      config.Retention,
+		scheduler:      registerSecheduler(config.Metric, config.Retention),
 	}
 	chainMetric.registerMetric()
 	initSlot(uint64(config.Chain.StartBlock))
@@ -51,12 +61,13 @@ func (c *ChainMetrics) registerMetric() {
 	prometheus.MustRegister(c.getStakeCollector()...)
 }
 
-func registerSecheduler(cfg config.MetricConfig) *gocron.Scheduler {
+func registerSecheduler(cfg config.MetricConfig, retention config.RetentionConfig) *gocron.Scheduler {
 	s := gocron.NewScheduler(time.UTC)
 	initHandler(cfg)
 	for _, handler := range Handlers {
-		s.Every(handler.interval).Seconds().Do(handler.handler)
+		s.Every(handler.interval).Seconds().Do(handlerRuns.track(handler.name, handler.handler))
 	}
+	s.Every(retention.Interval).Seconds().Do(handlerRuns.track("retention", handlerRetention))
 	return s
 }
 
@@ -84,6 +95,9 @@ func (cm *ChainMetrics) waitSchedule() error {
 func (cm *ChainMetrics) serve() {
 	go func() {
 		http.Handle("/metrics", promhttp.Handler())
+		registerApi()
+		http.HandleFunc("/healthz", healthz)
+		http.HandleFunc("/readyz", readyz)
 		err := http.ListenAndServe(fmt.Sprintf(":%d", cm.config.Port), nil)
 		if errors.Is(err, http.ErrServerClosed) {
 			log.Info("Health status server is shutting down", err)
@@ -0,0 +1,66 @@
+package metrics
+
+import (
+	"statistic/config"
+	"time"
+
+	log "github.com/ChainSafe/log15"
+)
+
+// retentionPause is the pause between two pruned batches, so that the listener is not blocked for long
+const retentionPause = 100 * time.Millisecond
+
+// handlerRetention prunes the history tables by their retention policies
+func handlerRetention() error {
+	cfg := chainMetric.retention
+	policies, err := cfg.Policies()
+	if err != nil {
+		log.Error("parse retention policies error", "err", err)
+		return err
+	}
+	current, err := chainMetric.store.GetBlockNumber()
+	if err != nil {
+		log.Error("get block number error", "err", err)
+		return err
+	}
+	var failed error
+	for table, policy := range policies {
+		if current <= policy.Blocks {
+			continue
+		}
+		// only whole slots are pruned, so that a rolled up slot is complete
+		before := getSlot(current - policy.Blocks)
+		pruned, err := pruneTable(table, policy, before, cfg.BatchSize)
+		chainMetric.prunedRows.WithLabelValues(table).Add(float64(pruned))
+		if err != nil {
+			log.Error("prune history error", "table", table, "err", err)
+			failed = err
+			continue
+		}
+		log.Info("prune history done", "table", table, "before", before, "pruned", pruned)
+	}
+	return failed
+}
+
+func pruneTable(table string, policy config.RetentionPolicy, before uint64, batchSize int) (int64, error) {
+	if policy.Rollup {
+		err := chainMetric.store.RollupHistory(table, before)
+		if err != nil {
+			return 0, err
+		}
+	}
+	var total int64
+	for {
+		select {
+		case <-chainMetric.stop:
+			return total, nil
+		default:
+		}
+		pruned, err := chainMetric.store.PruneHistory(table, before, batchSize)
+		total += pruned
+		if err != nil || pruned < int64(batchSize) {
+			return total, err
+		}
+		time.Sleep(retentionPause)
+	}
+}
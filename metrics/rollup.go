@@ -0,0 +1,68 @@
+package metrics
+
+import (
+	"math"
+	"statistic/config"
+	"statistic/db"
+)
+
+// sumStats adds up the file stat buckets accepted by match
+func sumStats(stats []db.FileStat, match func(bucket uint64) bool) db.FileStat {
+	var sum db.FileStat
+	for _, st := range stats {
+		if !match(st.Bucket) {
+			continue
+		}
+		sum.Files += st.Files
+		sum.Bytes += st.Bytes
+		sum.Replicas += st.Replicas
+		sum.Spower += st.Spower
+		sum.Reported += st.Reported
+	}
+	return sum
+}
+
+func allBuckets(uint64) bool {
+	return true
+}
+
+func avgReplicas(st db.FileStat) float64 {
+	if st.Files == 0 {
+		return 0
+	}
+	return float64(st.Replicas) / float64(st.Files)
+}
+
+// sizeBuckets accepts the size buckets in [c.low, c.high)
+func sizeBuckets(c *condition) func(bucket uint64) bool {
+	return func(bucket uint64) bool {
+		low := float64(db.SizeBuckets[bucket])
+		return low >= c.low && low < c.high
+	}
+}
+
+// replicaBuckets accepts the replica counts in (c.low, c.high], or 0 if both are 0
+func replicaBuckets(c *condition) func(bucket uint64) bool {
+	return func(bucket uint64) bool {
+		if c.low == 0 && c.high == 0 {
+			return bucket == 0
+		}
+		return float64(bucket) > c.low && float64(bucket) <= c.high
+	}
+}
+
+// slotBuckets accepts the slots starting in the block range (low, high]
+func slotBuckets(low, high uint64) func(bucket uint64) bool {
+	return func(bucket uint64) bool {
+		return bucket > low && bucket <= high
+	}
+}
+
+// slotRange returns the slots [from, to) starting in the block range (low, high], to is 0 if high is unbounded
+func slotRange(low, high uint64) (uint64, uint64) {
+	from := getSlot(low) + config.SlotBlocks
+	if high == math.MaxUint64 {
+		return from, 0
+	}
+	return from, getSlot(high) + config.SlotBlocks
+}
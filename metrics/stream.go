@@ -0,0 +1,139 @@
+package metrics
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"statistic/chain"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/ChainSafe/log15"
+)
+
+// streamKeepAlive is how often an idle stream sends a comment, so that proxies keep the connection open
+const streamKeepAlive = 30 * time.Second
+
+type changeFilter struct {
+	cidPrefix string
+	account   string
+	from      uint64
+}
+
+func (f *changeFilter) match(c *chain.Change) bool {
+	if c.Block < f.from || !strings.HasPrefix(c.Cid, f.cidPrefix) {
+		return false
+	}
+	if f.account == "" {
+		return true
+	}
+	for _, acc := range c.Accounts {
+		if acc == f.account {
+			return true
+		}
+	}
+	return false
+}
+
+// streamChanges serves GET /api/stream as server-sent events, one event per file change applied by the listener.
+// Clients filter with cid (a cid prefix) and account, and resume with from (a block number) or the Last-Event-ID header.
+func streamChanges(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeJSON(w, http.StatusMethodNotAllowed, apiError{"method not allowed"})
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeJSON(w, http.StatusInternalServerError, apiError{"streaming unsupported"})
+		return
+	}
+	feed := chainMetric.feed
+	filter := changeFilter{
+		cidPrefix: r.URL.Query().Get("cid"),
+		account:   r.URL.Query().Get("account"),
+	}
+	from, err := queryUint64(r, "from")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if from != nil {
+		filter.from = *from
+	}
+
+	var changes []chain.Change
+	var wait <-chan struct{}
+	var seq uint64
+	if id := r.Header.Get("Last-Event-ID"); id != "" {
+		seq, err = strconv.ParseUint(id, 10, 64)
+		if err != nil {
+			writeError(w, &badRequest{"invalid Last-Event-ID: " + id})
+			return
+		}
+		changes, seq, wait, err = feed.After(seq)
+	} else if from != nil {
+		changes, seq, wait, err = feed.From(*from)
+	} else {
+		// only the changes published from now on
+		seq, wait = feed.Latest()
+	}
+	if errors.Is(err, chain.ErrChangesPruned) {
+		writeJSON(w, http.StatusGone, apiError{err.Error()})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		for i := range changes {
+			if !filter.match(&changes[i]) {
+				continue
+			}
+			if err = writeChange(w, &changes[i]); err != nil {
+				log.Debug("Stream client gone", "err", err)
+				return
+			}
+		}
+		flusher.Flush()
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-chainMetric.stop:
+			return
+		case <-keepAlive.C:
+			if _, err = fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+			changes = nil
+			continue
+		case <-wait:
+		}
+		changes, seq, wait, err = feed.After(seq)
+		if err != nil {
+			// the client is slower than the buffer, it has to resume from its last event
+			fmt.Fprintf(w, "event: error\ndata: {\"error\":%q}\n\n", err.Error())
+			flusher.Flush()
+			return
+		}
+	}
+}
+
+func writeChange(w http.ResponseWriter, c *chain.Change) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", c.Seq, c.Type, data)
+	return err
+}
@@ -0,0 +1,84 @@
+package metrics
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"statistic/chain"
+	"strings"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+)
+
+// openStream connects to the stream of server, the body is closed when the test ends
+func openStream(t *testing.T, server *httptest.Server, query string, lastEventId string) (*http.Response, *bufio.Reader) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/api/stream"+query, nil)
+	assert.NilError(t, err)
+	if lastEventId != "" {
+		req.Header.Set("Last-Event-ID", lastEventId)
+	}
+	resp, err := server.Client().Do(req)
+	assert.NilError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp, bufio.NewReader(resp.Body)
+}
+
+// readEventIds reads the ids of the next n events
+func readEventIds(t *testing.T, r *bufio.Reader, n int) []string {
+	ids := make([]string, 0, n)
+	for len(ids) < n {
+		line, err := r.ReadString('\n')
+		assert.NilError(t, err)
+		if strings.HasPrefix(line, "id: ") {
+			ids = append(ids, strings.TrimSpace(strings.TrimPrefix(line, "id: ")))
+		}
+	}
+	return ids
+}
+
+func TestStreamChanges(t *testing.T) {
+	newTestMetrics(t)
+	feed := chain.NewChangeFeed(3, 100)
+	chainMetric.feed = feed
+	server := httptest.NewServer(http.HandlerFunc(streamChanges))
+	// registered before the streams, so the streams are closed first
+	t.Cleanup(server.Close)
+	feed.Publish([]chain.Change{{Block: 100, Type: chain.ChangeNew, Cid: "QmA", Accounts: []string{"a"}}, {Block: 100, Type: chain.ChangeNew, Cid: "QmB"}})
+
+	resp, events := openStream(t, server, "?from=100", "")
+	assert.Equal(t, resp.StatusCode, http.StatusOK)
+	assert.Equal(t, resp.Header.Get("Content-Type"), "text/event-stream")
+	assert.DeepEqual(t, readEventIds(t, events, 2), []string{"1", "2"})
+	// changes published while connected are pushed
+	feed.Publish([]chain.Change{{Block: 101, Type: chain.ChangeClose, Cid: "QmA", Accounts: []string{"a"}}})
+	assert.DeepEqual(t, readEventIds(t, events, 1), []string{"3"})
+
+	// a client resumes after its last event
+	_, events = openStream(t, server, "", "1")
+	assert.DeepEqual(t, readEventIds(t, events, 2), []string{"2", "3"})
+	_, events = openStream(t, server, "?from=100&cid=QmB", "")
+	assert.DeepEqual(t, readEventIds(t, events, 1), []string{"2"})
+	_, events = openStream(t, server, "?from=101&account=a", "")
+	assert.DeepEqual(t, readEventIds(t, events, 1), []string{"3"})
+
+	// block 100 drops out of the buffer
+	feed.Publish([]chain.Change{{Block: 102, Type: chain.ChangeNew, Cid: "QmC"}})
+	resp, _ = openStream(t, server, "?from=100", "")
+	assert.Equal(t, resp.StatusCode, http.StatusGone)
+	resp, _ = openStream(t, server, "", "0")
+	assert.Equal(t, resp.StatusCode, http.StatusGone)
+	resp, _ = openStream(t, server, "", "5")
+	assert.Equal(t, resp.StatusCode, http.StatusGone)
+	_, events = openStream(t, server, "", "2")
+	assert.DeepEqual(t, readEventIds(t, events, 2), []string{"3", "4"})
+
+	resp, _ = openStream(t, server, "", "abc")
+	assert.Equal(t, resp.StatusCode, http.StatusBadRequest)
+	resp, _ = openStream(t, server, "?from=abc", "")
+	assert.Equal(t, resp.StatusCode, http.StatusBadRequest)
+}